@@ -0,0 +1,444 @@
+package dorm
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// Privileges that can be granted on a table. ALL stands for all four.
+const (
+	PrivSelect = "SELECT"
+	PrivInsert = "INSERT"
+	PrivUpdate = "UPDATE"
+	PrivDelete = "DELETE"
+	PrivAll    = "ALL"
+)
+
+// grantsTable is the dorm-managed system table that persists grants.
+// A table_name of "*" grants the privilege on every table, and an empty
+// column_name grants it on every column of the table. The grantee is a
+// user or a role.
+const grantsTable = "dorm_grants"
+
+// rolesTable is the dorm-managed system table that records which users and
+// roles are members of which roles.
+const rolesTable = "dorm_roles"
+
+// systemPrefix starts the name of every dorm-managed system table. Session
+// handles may not touch these tables, whatever they have been granted.
+const systemPrefix = "dorm_"
+
+// isSystemTable reports whether table is a dorm-managed system table.
+func isSystemTable(table string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.Trim(table, "\"`[]")), systemPrefix)
+}
+
+var allPrivileges = []string{PrivSelect, PrivInsert, PrivUpdate, PrivDelete}
+
+// privilege is one privilege named in a permission, optionally restricted
+// to some columns.
+type privilege struct {
+	name    string
+	columns []string
+}
+
+// A Masker returns the value a session user sees in place of value, which
+// was read from a column of table the user may not select. If it returns
+// nil, or a value not assignable to the field, the field is left at its
+// zero value.
+type Masker func(table string, column string, value interface{}) interface{}
+
+// As returns a session handle that acts on behalf of userid. Every
+// operation issued through the handle is checked against the privileges
+// granted to userid and fails with ErrPermissionDenied if the user lacks
+// them. Handles obtained from NewDB are unrestricted.
+
+// Example usage:
+//    db.Grant("alice", "SELECT, INSERT ON post")
+//    alice := db.As("alice")
+//    alice.Create(post)                  // ok
+//    _, err := alice.TryDelete(post)     // ErrPermissionDenied
+func (db *DB) As(userid string) *DB {
+	c := *db
+	c.user = userid
+	return &c
+}
+
+// User returns the user a session handle acts on behalf of, or "" if the
+// handle is unrestricted.
+func (db *DB) User() string {
+	return db.user
+}
+
+// SetMasker sets how columns a session user may not select are presented
+// to them. By default such columns read as their zero value.
+// Handles later derived from db inherit the masker.
+
+// Example usage:
+//    db.SetMasker(func(table, column string, value interface{}) interface{} {
+//        if s, ok := value.(string); ok && s != "" {
+//            return "****"
+//        }
+//        return nil
+//    })
+func (db *DB) SetMasker(m Masker) {
+	db.masker = m
+}
+
+// Grant gives privileges on a table to userid, which may also name a role
+// (see GrantRole).
+// permission has the form "<privileges> ON <table>", where <privileges> is
+// a comma separated list of SELECT, INSERT, UPDATE, DELETE or ALL, and
+// <table> is a table name or "*" for every table; "ON <table>" may be
+// omitted to mean "ON *". No grant covers dorm's own dorm_* tables. A privilege other than ALL may be restricted to
+// some columns by listing them in parentheses after it.
+
+// Example usage:
+//    db.Grant("alice", "SELECT, UPDATE ON post")
+//    db.Grant("bob", "SELECT(full_name), UPDATE(full_name) ON user2")
+func (db *DB) Grant(userid string, permission string) {
+	if err := db.TryGrant(userid, permission); err != nil {
+		log.Panic(err)
+	}
+}
+
+// TryGrant is like Grant, but returns an error instead of panicking.
+func (db *DB) TryGrant(userid string, permission string) error {
+	privs, table, err := parsePermission(permission)
+	if err != nil {
+		return newErr("Grant", "", nil, "%v", err)
+	}
+	if err := db.requireAdmin("Grant", table); err != nil {
+		return err
+	}
+	if err := db.createACLTables(); err != nil {
+		return wrapErr("Grant", grantsTable, err)
+	}
+	for _, priv := range privs {
+		for _, col := range priv.columnsOrTable() {
+			_, err := db.exec("INSERT OR IGNORE INTO "+grantsTable+" (grantee, privilege, table_name, column_name) VALUES (?, ?, ?, ?)",
+				userid, priv.name, table, col)
+			if err != nil {
+				return wrapErr("Grant", grantsTable, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Revoke takes back privileges on a table previously given to userid by
+// Grant. permission has the same form as for Grant. Only grants that match
+// exactly are removed, so revoking SELECT ON post affects neither a grant of
+// SELECT ON * nor one of SELECT(author) ON post.
+func (db *DB) Revoke(userid string, permission string) {
+	if err := db.TryRevoke(userid, permission); err != nil {
+		log.Panic(err)
+	}
+}
+
+// TryRevoke is like Revoke, but returns an error instead of panicking.
+func (db *DB) TryRevoke(userid string, permission string) error {
+	privs, table, err := parsePermission(permission)
+	if err != nil {
+		return newErr("Revoke", "", nil, "%v", err)
+	}
+	if err := db.requireAdmin("Revoke", table); err != nil {
+		return err
+	}
+	if err := db.createACLTables(); err != nil {
+		return wrapErr("Revoke", grantsTable, err)
+	}
+	for _, priv := range privs {
+		for _, col := range priv.columnsOrTable() {
+			_, err := db.exec("DELETE FROM "+grantsTable+" WHERE grantee = ? AND privilege = ? AND table_name = ? AND column_name = ?",
+				userid, priv.name, table, col)
+			if err != nil {
+				return wrapErr("Revoke", grantsTable, err)
+			}
+		}
+	}
+	return nil
+}
+
+// createACLTables creates the grants and roles tables if they do not exist
+// yet.
+func (db *DB) createACLTables() error {
+	_, err := db.exec(`CREATE TABLE IF NOT EXISTS ` + grantsTable + ` (
+		grantee text NOT NULL,
+		privilege text NOT NULL,
+		table_name text NOT NULL,
+		column_name text NOT NULL DEFAULT '',
+		PRIMARY KEY (grantee, privilege, table_name, column_name)
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.exec(`CREATE TABLE IF NOT EXISTS ` + rolesTable + ` (
+		member text NOT NULL,
+		role text NOT NULL,
+		PRIMARY KEY (member, role)
+	)`)
+	return err
+}
+
+// columnsOrTable returns the columns p is restricted to, or a single empty
+// column name, meaning the whole table, if it is not restricted.
+func (p privilege) columnsOrTable() []string {
+	if len(p.columns) == 0 {
+		return []string{""}
+	}
+	return p.columns
+}
+
+// parsePermission parses a permission of the form accepted by Grant into
+// the privileges it names (with ALL expanded) and the table they apply to.
+func parsePermission(permission string) ([]privilege, string, error) {
+	spec, table := permission, "*"
+	if i := strings.Index(strings.ToUpper(permission), " ON "); i >= 0 {
+		spec, table = permission[:i], strings.TrimSpace(permission[i+4:])
+	}
+	if table == "" {
+		return nil, "", fmt.Errorf("missing table in permission %q", permission)
+	}
+
+	// split spec on the commas that are not inside a column list
+	parts := []string{}
+	depth, start := 0, 0
+	for i, c := range spec {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, spec[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, spec[start:])
+
+	privs := []privilege{}
+	for _, part := range parts {
+		p := privilege{name: strings.TrimSpace(part)}
+		if i := strings.Index(p.name, "("); i >= 0 {
+			if !strings.HasSuffix(p.name, ")") {
+				return nil, "", fmt.Errorf("malformed column list in permission %q", permission)
+			}
+			for _, col := range strings.Split(p.name[i+1:len(p.name)-1], ",") {
+				if col = strings.TrimSpace(col); col != "" {
+					p.columns = append(p.columns, col)
+				}
+			}
+			if len(p.columns) == 0 {
+				return nil, "", fmt.Errorf("empty column list in permission %q", permission)
+			}
+			p.name = strings.TrimSpace(p.name[:i])
+		}
+		p.name = strings.ToUpper(p.name)
+
+		switch p.name {
+		case PrivAll:
+			if len(p.columns) > 0 {
+				return nil, "", fmt.Errorf("ALL cannot be restricted to columns in permission %q", permission)
+			}
+			for _, name := range allPrivileges {
+				privs = append(privs, privilege{name: name})
+			}
+		case PrivSelect, PrivInsert, PrivUpdate, PrivDelete:
+			privs = append(privs, p)
+		default:
+			return nil, "", fmt.Errorf("unknown privilege %q in permission %q", p.name, permission)
+		}
+	}
+	return privs, table, nil
+}
+
+// requireAdmin returns ErrPermissionDenied if db is a session handle.
+// Schema changes and grants can only be made through an unrestricted
+// handle.
+func (db *DB) requireAdmin(op string, table string) error {
+	if db.user == "" {
+		return nil
+	}
+	return db.deny(op, table, "user %q may not %v", db.user, op)
+}
+
+// grantSet is the set of privileges a session user holds on one table.
+// A nil *grantSet stands for an unrestricted handle, which holds every
+// privilege.
+type grantSet struct {
+	table   map[string]bool            // privileges on the whole table
+	columns map[string]map[string]bool // privilege -> columns it covers
+}
+
+// has reports whether s includes privilege on at least part of the table.
+func (s *grantSet) has(privilege string) bool {
+	return s == nil || s.table[privilege] || len(s.columns[privilege]) > 0
+}
+
+// hasTable reports whether s includes privilege on the whole table.
+func (s *grantSet) hasTable(privilege string) bool {
+	return s == nil || s.table[privilege]
+}
+
+// hasColumn reports whether s includes privilege on column.
+func (s *grantSet) hasColumn(privilege string, column string) bool {
+	return s == nil || s.table[privilege] || s.columns[privilege][column]
+}
+
+// add adds privilege on column, or on the whole table if column is "", to s.
+func (s *grantSet) add(privilege string, column string) {
+	if column == "" {
+		s.table[privilege] = true
+		return
+	}
+	if s.columns[privilege] == nil {
+		s.columns[privilege] = map[string]bool{}
+	}
+	s.columns[privilege][column] = true
+}
+
+// merge adds every privilege in other to s.
+func (s *grantSet) merge(other *grantSet) {
+	if other == nil {
+		return
+	}
+	for priv := range other.table {
+		s.add(priv, "")
+	}
+	for priv, cols := range other.columns {
+		for col := range cols {
+			s.add(priv, col)
+		}
+	}
+}
+
+func newGrantSet() *grantSet {
+	return &grantSet{table: map[string]bool{}, columns: map[string]map[string]bool{}}
+}
+
+// userGrants is every privilege a session user holds, keyed by table name,
+// with "*" for privileges held on every table.
+type userGrants map[string]*grantSet
+
+// on returns the privileges held on table.
+func (g userGrants) on(table string) *grantSet {
+	s := newGrantSet()
+	s.merge(g["*"])
+	s.merge(g[table])
+	return s
+}
+
+// loadGrants loads the privileges db's session user holds, directly or
+// through the roles they belong to, restricted to table if it is not "".
+// It returns nil if db is unrestricted.
+func (db *DB) loadGrants(table string) (userGrants, error) {
+	if db.user == "" {
+		return nil, nil
+	}
+	query := "SELECT table_name, privilege, column_name FROM " + grantsTable +
+		" WHERE grantee IN (" + memberOf + ")"
+	args := []interface{}{db.user}
+	if table != "" {
+		query += " AND table_name IN (?, '*')"
+		args = append(args, table)
+	}
+
+	g := userGrants{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var tbl, priv, col string
+			if err := rows.Scan(&tbl, &priv, &col); err != nil {
+				return err
+			}
+			if g[tbl] == nil {
+				g[tbl] = newGrantSet()
+			}
+			g[tbl].add(priv, col)
+		}
+		return rows.Err()
+	}, query, args...)
+	if err != nil && classify(err) != ErrTableNotFound {
+		return nil, err
+	}
+	return g, nil
+}
+
+// grants loads the privileges db's session user holds on table, or returns
+// nil if db is unrestricted.
+func (db *DB) grants(table string) (*grantSet, error) {
+	g, err := db.loadGrants(table)
+	if g == nil || err != nil {
+		return nil, err
+	}
+	return g.on(table), nil
+}
+
+// authorize returns ErrPermissionDenied if db is a session handle whose
+// user holds privilege on no part of table, or if table is a system table.
+// Otherwise it returns the user's privileges on table, for column-level
+// checks.
+func (db *DB) authorize(op string, privilege string, table string) (*grantSet, error) {
+	// a grant ON * must not let a user grant itself more
+	if db.user != "" && isSystemTable(table) {
+		return nil, db.deny(op, table, "user %q may not access system table %v", db.user, table)
+	}
+	s, err := db.grants(table)
+	if err != nil {
+		return nil, wrapErr(op, table, err)
+	}
+	if !s.has(privilege) {
+		return nil, db.deny(op, table, "user %q lacks %v on %v", db.user, privilege, table)
+	}
+	return s, nil
+}
+
+// authorizeColumns returns ErrPermissionDenied unless s includes privilege
+// on each of columns.
+func (db *DB) authorizeColumns(op string, s *grantSet, privilege string, table string, columns []string) error {
+	for _, col := range columns {
+		if !s.hasColumn(privilege, col) {
+			return db.deny(op, table, "user %q lacks %v on %v.%v", db.user, privilege, table, col)
+		}
+	}
+	return nil
+}
+
+// mask replaces the fields of model, a struct value read from table, that
+// the grants s do not allow the session user to select.
+func (db *DB) mask(s *grantSet, table string, model reflect.Value) {
+	if s == nil || s.table[PrivSelect] {
+		return
+	}
+	m := db.modelOf(model.Type())
+	for _, i := range m.fields {
+		col := m.columns[i]
+		if s.hasColumn(PrivSelect, col) {
+			continue
+		}
+		field := model.Field(i)
+		if db.masker != nil {
+			masked := db.masker(table, col, field.Interface())
+			if masked != nil && reflect.TypeOf(masked).AssignableTo(field.Type()) {
+				field.Set(reflect.ValueOf(masked))
+				continue
+			}
+		}
+		field.Set(reflect.Zero(field.Type()))
+	}
+}
+
+// maskRows applies mask to the rows appended to result, a pointer to a
+// slice of models, from index from onwards.
+func (db *DB) maskRows(s *grantSet, table string, result interface{}, from int) {
+	if s == nil || s.table[PrivSelect] {
+		return
+	}
+	rows := reflect.ValueOf(result).Elem()
+	for i := from; i < rows.Len(); i++ {
+		db.mask(s, table, rows.Index(i))
+	}
+}
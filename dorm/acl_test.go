@@ -0,0 +1,302 @@
+package dorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestGrantSelect(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	alice := db.As("alice")
+	results := []User{}
+	if err := alice.TryFind(&results); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied before any grant but got %v", err)
+	}
+
+	db.Grant("alice", "SELECT ON user")
+
+	if err := alice.TryFind(&results); err != nil || len(results) != len(MockUsers) {
+		t.Errorf("Expected %d users but found %d, %v", len(MockUsers), len(results), err)
+	}
+	if err := alice.TryFirst(&User{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := alice.TryTopN(&[]User{}, 2); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := alice.TryFilter(&[]User{}, &User{FullName: "Bob Smith"}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := alice.Model(&User{}).Find(&[]User{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := alice.TryQuery(&[]User{}, "select * from user"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	if err := alice.TryCreate(&User{FullName: "Frelicia"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if _, err := alice.TryDelete(&User{FullName: "Bob Smith"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := db.As("bob").TryFind(&results); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied for another user but got %v", err)
+	}
+}
+
+func TestGrantAllAndRevoke(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "ALL ON post")
+	alice := db.As("alice")
+
+	post := &Post{Author: "alice", Likes: 1}
+	if err := alice.TryCreate(post); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if _, err := alice.UpdateColumns(post, "likes"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	db.Revoke("alice", "UPDATE, DELETE ON post")
+	if _, err := alice.Update(post); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if _, err := alice.TryDelete(post); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := alice.TryFind(&[]Post{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestGrantAllTables(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	createPostTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("carol", "select")
+	carol := db.As("carol")
+	if err := carol.TryFind(&[]User{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := carol.TryFind(&[]Post{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	// session handles cannot grant themselves more or change the schema
+	if err := carol.TryGrant("carol", "ALL"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	type NewTable struct {
+		Name string
+	}
+	if err := carol.TryCreateTable(&NewTable{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+// grantRow maps the grants table, which session handles may not reach
+// through a model either.
+type grantRow struct {
+	Grantee   string
+	Privilege string
+	Table     string `dorm:"column:table_name"`
+	Column    string `dorm:"column:column_name"`
+}
+
+func (grantRow) TableName() string {
+	return grantsTable
+}
+
+func TestGrantSystemTables(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, []User2{{FullName: "Alice"}})
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("mallory", "ALL ON *")
+	mallory := db.As("mallory")
+	if err := mallory.TryFind(&[]User2{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	// ON * does not cover the system tables
+	if err := mallory.TryCreate(&grantRow{Grantee: "mallory", Privilege: PrivDelete, Table: "*"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := mallory.TryFind(&[]grantRow{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if _, err := mallory.DeleteWhere(&grantRow{}, "1 = 1"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	rows := []grantRow{}
+	if err := db.TryFind(&rows); err != nil || len(rows) != len(allPrivileges) {
+		t.Errorf("Expected mallory's %d grants untouched but found %v, %v", len(allPrivileges), rows, err)
+	}
+}
+
+func TestGrantInvalidPermission(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	for _, permission := range []string{"DROP ON user", "SELECT ON ", ""} {
+		if err := db.TryGrant("alice", permission); err == nil {
+			t.Errorf("Expected an error for permission %q", permission)
+		}
+	}
+}
+
+// Check that grants made in a transaction roll back with it
+func TestGrantTransaction(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Transaction(func(tx *Tx) error {
+		tx.Grant("alice", "SELECT ON user")
+		if err := tx.As("alice").TryFind(&[]User{}); err != nil {
+			t.Errorf("Expected no error but got %v", err)
+		}
+		return errors.New("abort")
+	})
+	if err := db.As("alice").TryFind(&[]User{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+func TestGrantColumnsMasksReads(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, MockUsers3)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("bob", "SELECT(full_name) ON user2")
+	bob := db.As("bob")
+
+	results := []User2{}
+	if err := bob.TryFind(&results); err != nil {
+		t.Fatal(err)
+	}
+	expectedResults := []User2{
+		User2{FullName: "Test User1"},
+		User2{FullName: "Frelicia"},
+	}
+	if !reflect.DeepEqual(results, expectedResults) {
+		t.Errorf("Expected %v but found %v", expectedResults, results)
+	}
+
+	first := &User2{}
+	if err := bob.Model(&User2{}).Where("full_name = ?", "Frelicia").First(first); err != nil || first.EMail != "" {
+		t.Errorf("Expected e_mail to be masked but found %v, %v", *first, err)
+	}
+
+	// filtering or sorting on a hidden column would reveal it
+	if err := bob.TryFilter(&[]User2{}, &User2{EMail: "f@t"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	results = []User2{}
+	if err := bob.Model(&User2{}).Where("e_mail LIKE 'f@%'").Find(&results); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v, %v", results, err)
+	}
+	if err := bob.Model(&User2{}).Order("e_mail").Find(&[]User2{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := bob.Model(&User2{}).Where("full_name IN (SELECT full_name FROM user2 WHERE e_mail != '')").Find(&[]User2{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := bob.TryFilter(&[]User2{}, &User2{FullName: "Frelicia"}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	bob.SetMasker(func(table, column string, value interface{}) interface{} {
+		if s, ok := value.(string); ok && s != "" {
+			return "****"
+		}
+		return nil
+	})
+	results = []User2{}
+	if err := bob.TryTopN(&results, 2); err != nil {
+		t.Fatal(err)
+	}
+	if results[0].EMail != "" || results[1].EMail != "****" {
+		t.Errorf("Expected e_mail to be masked with **** but found %v", results)
+	}
+
+	// unrestricted handles see everything
+	results = []User2{}
+	db.Find(&results)
+	if results[1].EMail != "f@t" {
+		t.Errorf("Expected f@t but found %v", results[1].EMail)
+	}
+}
+
+func TestGrantColumnsRestrictsWrites(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("bob", "SELECT, INSERT(author), UPDATE(likes) ON post")
+	bob := db.As("bob")
+
+	if _, err := bob.UpdateColumns(&Post{ID: 1, Likes: 99}, "likes"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if _, err := bob.Update(&Post{ID: 1, Author: "bob", Likes: 99}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	post := &Post{Author: "bob"}
+	if err := bob.TryCreate(post); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := bob.TryCreate(&Post{Author: "bob", Likes: 1000}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	results := []Post{}
+	db.Find(&results)
+	if len(results) != len(MockPosts)+1 || results[0].Likes != 99 || results[0].Author != "alice" {
+		t.Errorf("incorrect")
+		fmt.Println(results)
+	}
+
+	db.Revoke("bob", "UPDATE(likes) ON post")
+	if _, err := bob.UpdateColumns(&Post{ID: 1, Likes: 1}, "likes"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	if err := db.TryGrant("bob", "ALL(likes) ON post"); err == nil {
+		t.Errorf("Expected an error restricting ALL to columns")
+	}
+}
@@ -0,0 +1,340 @@
+package dorm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// auditTable is the dorm-managed system table that records the audit log.
+const auditTable = "dorm_audit"
+
+// Operations recorded in the audit log.
+const (
+	AuditInsert = "INSERT"
+	AuditUpdate = "UPDATE"
+	AuditDelete = "DELETE"
+	AuditDenied = "DENIED"
+)
+
+// An AuditEntry records one row changed through dorm, or one operation
+// refused for lack of privileges.
+type AuditEntry struct {
+	ID         int64
+	At         time.Time
+	User       string // the session user, or "" for an unrestricted handle
+	Table      string
+	Operation  string // one of AuditInsert, AuditUpdate, AuditDelete or AuditDenied
+	PrimaryKey int64  // the rowid, that is the INTEGER PRIMARY KEY, of the row; 0 for denials
+	Before     string // the row before the change, as a JSON object, or ""
+	After      string // the row after the change, as a JSON object, or ""
+	Detail     string // the SQL of a raw query, or why an operation was denied
+}
+
+// rowSnapshot is a row captured for the audit log.
+type rowSnapshot struct {
+	rowid  int64
+	values string // JSON object of column -> value
+}
+
+// EnableAudit turns on the audit log for db and every handle derived from
+// the same NewDB, creating its table if needed. From then on Create, Save,
+// Update, UpdateColumns, Delete and writes made by raw queries each append
+// one entry per affected row, in the same transaction as the change, and
+// every ErrPermissionDenied is recorded as an AuditDenied entry. A denial
+// inside a transaction that is later rolled back is rolled back with it.
+// Raw writes are run twice, the first time as a rolled back trial that
+// tells which rows to capture before the change.
+func (db *DB) EnableAudit() error {
+	if err := db.requireAdmin("EnableAudit", auditTable); err != nil {
+		return err
+	}
+	_, err := db.exec(`CREATE TABLE IF NOT EXISTS ` + auditTable + ` (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		at timestamp NOT NULL,
+		user text NOT NULL,
+		table_name text NOT NULL,
+		operation text NOT NULL,
+		primary_key integer NOT NULL DEFAULT 0,
+		before text NOT NULL DEFAULT '',
+		after text NOT NULL DEFAULT '',
+		detail text NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		return wrapErr("EnableAudit", auditTable, err)
+	}
+	db.shared.mu.Lock()
+	db.shared.audit = true
+	db.shared.mu.Unlock()
+	return nil
+}
+
+// auditing reports whether the audit log is enabled.
+func (db *DB) auditing() bool {
+	db.shared.mu.RLock()
+	defer db.shared.mu.RUnlock()
+	return db.shared.audit
+}
+
+// audited runs fn, which changes rows and records them in the audit log,
+// inside a transaction so the change and its entries commit together.
+// It runs fn on db directly if auditing is off or db is already a
+// transaction.
+func (db *DB) audited(fn func(db *DB) error) error {
+	if !db.auditing() || db.tx != nil {
+		return fn(db)
+	}
+	err := db.Transaction(func(tx *Tx) error {
+		return fn(&tx.DB)
+	})
+	// a denial was recorded in the transaction, which has been rolled back
+	var e *Error
+	if errors.As(err, &e) && errors.Is(err, ErrPermissionDenied) {
+		db.appendAudit(AuditDenied, e.Table, 0, "", "", err.Error())
+	}
+	return err
+}
+
+// AuditTrail returns the audit log entries for the table of model, oldest
+// first. If model has a non-zero primary key, only the entries for that
+// row are returned. Only unrestricted handles may read the audit log.
+func (db *DB) AuditTrail(model interface{}) ([]AuditEntry, error) {
+	table := db.tableName(model)
+	if err := db.requireAdmin("AuditTrail", table); err != nil {
+		return nil, err
+	}
+	query := "SELECT id, at, user, table_name, operation, primary_key, before, after, detail FROM " + auditTable + " WHERE table_name = ?"
+	args := []interface{}{table}
+	t := reflect.TypeOf(model).Elem()
+	if pk := primaryKey(t); pk >= 0 && !reflect.ValueOf(model).Elem().Field(pk).IsZero() {
+		query += " AND primary_key = ? AND operation != ?"
+		args = append(args, reflect.ValueOf(model).Elem().Field(pk).Interface(), AuditDenied)
+	}
+	query += " ORDER BY id"
+
+	entries := []AuditEntry{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			e := AuditEntry{}
+			err := rows.Scan(&e.ID, &e.At, &e.User, &e.Table, &e.Operation, &e.PrimaryKey, &e.Before, &e.After, &e.Detail)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	}, query, args...)
+	if err != nil {
+		return nil, wrapErr("AuditTrail", auditTable, err)
+	}
+	return entries, nil
+}
+
+// snapshot captures the rows of table matching where, which may be "" to
+// capture every row, for the audit log. It returns nil if auditing is off.
+func (db *DB) snapshot(table string, where string, args ...interface{}) ([]rowSnapshot, error) {
+	if !db.auditing() {
+		return nil, nil
+	}
+	query := "SELECT rowid, * FROM " + table
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	snapshots := []rowSnapshot{}
+	err := db.query(func(rows *sql.Rows) error {
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			vals := make([]interface{}, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			row := map[string]interface{}{}
+			for i, col := range cols[1:] {
+				row[col] = vals[i+1]
+			}
+			values, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			rowid, _ := vals[0].(int64)
+			snapshots = append(snapshots, rowSnapshot{rowid: rowid, values: string(values)})
+		}
+		return rows.Err()
+	}, query, args...)
+	return snapshots, err
+}
+
+// snapshotRowids captures the rows of table with the given rowids.
+func (db *DB) snapshotRowids(table string, rowids []int64) ([]rowSnapshot, error) {
+	if !db.auditing() || len(rowids) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(rowids))
+	args := make([]interface{}, len(rowids))
+	for i, rowid := range rowids {
+		placeholders[i] = "?"
+		args[i] = rowid
+	}
+	return db.snapshot(table, "rowid IN ("+strings.Join(placeholders, ", ")+")", args...)
+}
+
+// auditRows appends an entry for operation on table for each row in before
+// and after, matched by rowid, where either may be missing. It does nothing
+// if auditing is off.
+func (db *DB) auditRows(operation string, table string, before []rowSnapshot, after []rowSnapshot, detail string) error {
+	if !db.auditing() {
+		return nil
+	}
+	rowids := []int64{}
+	old := map[int64]string{}
+	for _, s := range before {
+		rowids = append(rowids, s.rowid)
+		old[s.rowid] = s.values
+	}
+	changed := map[int64]string{}
+	for _, s := range after {
+		if _, ok := old[s.rowid]; !ok {
+			rowids = append(rowids, s.rowid)
+		}
+		changed[s.rowid] = s.values
+	}
+
+	for _, rowid := range rowids {
+		if err := db.appendAudit(operation, table, rowid, old[rowid], changed[rowid], detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendAudit writes one entry to the audit log.
+func (db *DB) appendAudit(operation string, table string, rowid int64, before string, after string, detail string) error {
+	_, err := db.exec("INSERT INTO "+auditTable+" (at, user, table_name, operation, primary_key, before, after, detail) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		time.Now().UTC(), db.user, table, operation, rowid, before, after, detail)
+	return err
+}
+
+// deny returns an ErrPermissionDenied for operation op on table, recording
+// it in the audit log if auditing is on. Failing to record a denial does
+// not change the error returned.
+func (db *DB) deny(op string, table string, format string, args ...interface{}) error {
+	err := newErr(op, table, ErrPermissionDenied, format, args...)
+	if db.auditing() {
+		db.appendAudit(AuditDenied, table, 0, "", "", err.Error())
+	}
+	return err
+}
+
+// rowRef identifies a row of a table by its rowid.
+type rowRef struct {
+	table string
+	rowid int64
+}
+
+// rowChange is a row changed by a raw query, as reported by the sqlite
+// update hook.
+type rowChange struct {
+	operation string
+	rowRef
+}
+
+// changeRecorder collects the rows a raw query changes. Like an authorizer,
+// the update hook must not run statements of its own, so the changed rows
+// are only read once the query is done.
+type changeRecorder struct {
+	changes []rowChange
+	seen    map[rowChange]bool
+}
+
+// record is the sqlite update hook callback.
+func (r *changeRecorder) record(op int, dbName string, table string, rowid int64) {
+	c := rowChange{rowRef: rowRef{table: table, rowid: rowid}}
+	switch op {
+	case sqlite3.SQLITE_INSERT:
+		c.operation = AuditInsert
+	case sqlite3.SQLITE_UPDATE:
+		c.operation = AuditUpdate
+	case sqlite3.SQLITE_DELETE:
+		c.operation = AuditDelete
+	default:
+		return
+	}
+	if table == auditTable || r.seen[c] {
+		return
+	}
+	if r.seen == nil {
+		r.seen = map[rowChange]bool{}
+	}
+	r.seen[c] = true
+	r.changes = append(r.changes, c)
+}
+
+// take returns the changes recorded so far and forgets them.
+func (r *changeRecorder) take() []rowChange {
+	changes := r.changes
+	r.changes, r.seen = nil, nil
+	return changes
+}
+
+// beforeImages captures the current values of the rows changes refer to,
+// keyed by row, with "" for rows that do not exist, as when they are yet
+// to be inserted.
+func (db *DB) beforeImages(changes []rowChange) (map[rowRef]string, error) {
+	images := map[rowRef]string{}
+	rowids := map[string][]int64{}
+	for _, c := range changes {
+		if _, ok := images[c.rowRef]; !ok {
+			images[c.rowRef] = ""
+			rowids[c.table] = append(rowids[c.table], c.rowid)
+		}
+	}
+	for table, ids := range rowids {
+		rows, err := db.snapshotRowids(table, ids)
+		if err != nil {
+			// the table itself may be created by the query
+			if classify(err) == ErrTableNotFound {
+				continue
+			}
+			return nil, err
+		}
+		for _, row := range rows {
+			images[rowRef{table: table, rowid: row.rowid}] = row.values
+		}
+	}
+	return images, nil
+}
+
+// audit appends an entry for each recorded change made by query, with the
+// values of the row in before, captured before the query ran, and its
+// current values.
+func (r *changeRecorder) audit(db *DB, query string, before map[rowRef]string) error {
+	for _, c := range r.changes {
+		after := ""
+		if c.operation != AuditDelete {
+			rows, err := db.snapshotRowids(c.table, []int64{c.rowid})
+			if err != nil {
+				return err
+			}
+			if len(rows) > 0 {
+				after = rows[0].values
+			}
+		}
+		if err := db.appendAudit(c.operation, c.table, c.rowid, before[c.rowRef], after, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func auditOperations(entries []AuditEntry) []string {
+	ops := []string{}
+	for _, e := range entries {
+		ops = append(ops, e.Operation)
+	}
+	return ops
+}
+
+func TestAuditWrites(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Grant("alice", "ALL ON post")
+	alice := db.As("alice")
+
+	post := &Post{Author: "alice", Likes: 1}
+	alice.Create(post)
+	post.Likes = 2
+	if _, err := alice.Update(post); err != nil {
+		t.Fatal(err)
+	}
+	alice.Delete(post)
+
+	entries, err := db.AuditTrail(&Post{ID: post.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{AuditInsert, AuditUpdate, AuditDelete}
+	if !reflect.DeepEqual(auditOperations(entries), expected) {
+		t.Fatalf("Expected %v but found %v", expected, auditOperations(entries))
+	}
+	for _, e := range entries {
+		if e.User != "alice" || e.Table != "post" || e.PrimaryKey != post.ID || e.At.IsZero() {
+			t.Errorf("Expected an entry by alice for post %d but found %+v", post.ID, e)
+		}
+	}
+	if entries[0].Before != "" || !strings.Contains(entries[0].After, `"likes":1`) {
+		t.Errorf("Expected the inserted row but found %+v", entries[0])
+	}
+	if !strings.Contains(entries[1].Before, `"likes":1`) || !strings.Contains(entries[1].After, `"likes":2`) {
+		t.Errorf("Expected the row before and after the update but found %+v", entries[1])
+	}
+	if !strings.Contains(entries[2].Before, `"likes":2`) || entries[2].After != "" {
+		t.Errorf("Expected the deleted row but found %+v", entries[2])
+	}
+
+	// deleting by author records each post deleted
+	if n, err := alice.DeleteWhere(&Post{}, "author = ?", "alice"); err != nil || n != 2 {
+		t.Errorf("Expected 2 posts deleted but got %d, %v", n, err)
+	}
+	entries, err = db.AuditTrail(&Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{AuditInsert, AuditUpdate, AuditDelete, AuditDelete, AuditDelete}
+	if !reflect.DeepEqual(auditOperations(entries), expected) {
+		t.Errorf("Expected %v but found %v", expected, auditOperations(entries))
+	}
+}
+
+func TestAuditRawQuery(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+
+	query := "update post set likes = likes + 1 where author = 'bob'"
+	if err := db.TryQuery(&[]Post{}, query); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TryQuery(&[]Post{}, "select * from post"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := db.AuditTrail(&Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries but found %d", len(entries))
+	}
+	if entries[0].Operation != AuditUpdate || entries[0].PrimaryKey != 2 || entries[0].Detail != query ||
+		!strings.Contains(entries[0].Before, `"likes":12`) || !strings.Contains(entries[0].After, `"likes":13`) {
+		t.Errorf("Expected the update of post 2 but found %+v", entries[0])
+	}
+
+	// deleted rows are recorded as they were
+	if _, err := db.Exec("delete from post where author = ?", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = db.AuditTrail(&Post{})
+	last := entries[len(entries)-1]
+	if last.Operation != AuditDelete || !strings.Contains(last.Before, `"author":"carol"`) || last.After != "" {
+		t.Errorf("Expected the delete of carol's post but found %+v", last)
+	}
+
+	// a query whose rows cannot be known beforehand is refused
+	if _, err := db.Exec("insert into post (id, author) values (abs(random()) % 1000000000 + 100, 'mallory')"); err == nil {
+		t.Errorf("Expected an error for a query that cannot be audited")
+	}
+	results := []Post{}
+	db.Model(&Post{}).Where("author = ?", "mallory").Find(&results)
+	if len(results) != 0 {
+		t.Errorf("Expected the refused insert to be rolled back but found %v", results)
+	}
+}
+
+func TestAuditDenied(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Grant("carol", "SELECT ON post")
+	carol := db.As("carol")
+
+	if _, err := carol.TryDelete(&Post{Author: "bob"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := carol.TryQuery(&[]Post{}, "delete from post"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	entries, err := db.AuditTrail(&Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{AuditDenied, AuditDenied}
+	if !reflect.DeepEqual(auditOperations(entries), expected) {
+		t.Fatalf("Expected %v but found %v", expected, auditOperations(entries))
+	}
+	if entries[0].User != "carol" || !strings.Contains(entries[0].Detail, "DELETE") {
+		t.Errorf("Expected carol's denied delete but found %+v", entries[0])
+	}
+
+	// nothing was deleted
+	results := []Post{}
+	db.Find(&results)
+	if len(results) != len(MockPosts) {
+		t.Errorf("Expected %d posts but found %d", len(MockPosts), len(results))
+	}
+
+	if _, err := carol.AuditTrail(&Post{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
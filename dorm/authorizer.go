@@ -0,0 +1,371 @@
+package dorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteRecursive is the authorizer action code for a recursive CTE, which
+// go-sqlite3 does not export.
+const sqliteRecursive = 33
+
+// denial records the first action an authorizer refused.
+type denial struct {
+	privilege string
+	table     string
+	column    string
+	reason    string
+}
+
+// rawAuthorizer vets the statements of a raw query issued by a session
+// user against the privileges they hold. sqlite consults it once per table
+// and column a statement touches while compiling the statement, which is
+// why the privileges are loaded beforehand: the callback must not run
+// statements of its own.
+type rawAuthorizer struct {
+	db       *DB
+	grants   userGrants
+	policies bool            // the statement applies every row policy itself
+	replaces bool            // the statement replaces rows on conflict
+	replace  map[string]bool // lower case names of tables declared ON CONFLICT REPLACE
+	denied   *denial
+}
+
+// authorize is the sqlite authorizer callback. For SQLITE_READ and
+// SQLITE_UPDATE, arg1 and arg2 are the table and column; for SQLITE_INSERT
+// and SQLITE_DELETE, arg1 is the table.
+func (a *rawAuthorizer) authorize(action int, arg1 string, arg2 string, dbName string) int {
+	// whatever the user holds ON *, it may not grant itself more or tamper
+	// with the audit log
+	if isSystemTable(arg1) {
+		return a.deny(denial{table: arg1, reason: "system table " + arg1 + " is not accessible"})
+	}
+	switch action {
+	case sqlite3.SQLITE_SELECT, sqlite3.SQLITE_FUNCTION, sqliteRecursive:
+		return sqlite3.SQLITE_OK
+	case sqlite3.SQLITE_READ:
+		if strings.HasPrefix(arg1, "sqlite_") {
+			return sqlite3.SQLITE_OK
+		}
+		// arg2 is empty when a statement touches the table but no column,
+		// as in count(*)
+		if arg2 == "" {
+			return a.check(PrivSelect, arg1, "", a.grants.on(arg1).has(PrivSelect))
+		}
+		return a.check(PrivSelect, arg1, arg2, a.grants.on(arg1).hasColumn(PrivSelect, arg2))
+	case sqlite3.SQLITE_INSERT:
+		// sqlite names no columns for an insert, so a grant limited to some
+		// columns cannot be checked and does not allow it
+		if a.replacing(arg1) {
+			return a.deny(denial{table: arg1, reason: "replacing rows requires DELETE on " + arg1})
+		}
+		return a.check(PrivInsert, arg1, "", a.grants.on(arg1).hasTable(PrivInsert))
+	case sqlite3.SQLITE_UPDATE:
+		if a.replacing(arg1) {
+			return a.deny(denial{table: arg1, reason: "replacing rows requires DELETE on " + arg1})
+		}
+		return a.check(PrivUpdate, arg1, arg2, a.grants.on(arg1).hasColumn(PrivUpdate, arg2))
+	case sqlite3.SQLITE_DELETE:
+		return a.check(PrivDelete, arg1, "", a.grants.on(arg1).has(PrivDelete))
+	}
+	// schema changes, pragmas, attachments and transaction control are
+	// reserved for unrestricted handles
+	return a.deny(denial{table: arg1, reason: "statement not permitted in a raw query"})
+}
+
+// check allows an action on table if granted is true and no row policy
+// applies to table, unless a.policies is set, and denies it otherwise.
+func (a *rawAuthorizer) check(privilege string, table string, column string, granted bool) int {
+	if !granted {
+		return a.deny(denial{privilege: privilege, table: table, column: column})
+	}
+	if a.policies {
+		return sqlite3.SQLITE_OK
+	}
+	if policy, _ := a.db.rowPolicy(table); policy != "" {
+		return a.deny(denial{table: table, reason: "raw queries cannot be restricted by the row policy on " + table})
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// replacing reports whether a write to table may replace, and so delete,
+// rows that conflict with it, without the user holding DELETE on table.
+func (a *rawAuthorizer) replacing(table string) bool {
+	if !a.replaces && !a.replace[strings.ToLower(table)] {
+		return false
+	}
+	return !a.grants.on(table).hasTable(PrivDelete)
+}
+
+func (a *rawAuthorizer) deny(d denial) int {
+	if a.denied == nil {
+		a.denied = &d
+	}
+	return sqlite3.SQLITE_DENY
+}
+
+// err converts the first denial, if any, into an ErrPermissionDenied.
+func (a *rawAuthorizer) err(op string) error {
+	d := a.denied
+	if d == nil {
+		return nil
+	}
+	if d.reason != "" {
+		return a.db.deny(op, d.table, "user %q: %v", a.db.user, d.reason)
+	}
+	object := d.table
+	if d.column != "" {
+		object += "." + d.column
+	}
+	return a.db.deny(op, d.table, "user %q lacks %v on %v", a.db.user, d.privilege, object)
+}
+
+// queryAuthorized is like query, but if db is a session handle the
+// statement is vetted by a rawAuthorizer for its user, and any table or
+// column it is not allowed to touch makes it fail with ErrPermissionDenied.
+// If auditing is on, the rows the statement changes are recorded in the
+// audit log in the same transaction.
+func (db *DB) queryAuthorized(op string, fn func(rows *sql.Rows) error, query string, args ...interface{}) error {
+	return db.raw(op, false, query, args, func(ctx context.Context, conn executor) error {
+		rows, err := conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		return fn(rows)
+	})
+}
+
+// execAuthorized is like exec, but vets and audits the statement as
+// queryAuthorized does. It returns the number of rows affected.
+func (db *DB) execAuthorized(op string, query string, args ...interface{}) (int64, error) {
+	n := int64(0)
+	err := db.raw(op, false, query, args, func(ctx context.Context, conn executor) error {
+		res, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// qualified matches a table name qualified by its schema, which would
+// reach past the CTEs of policyScope to the table itself.
+var qualified = regexp.MustCompile(`(?i)\b(main|temp)\b["\x60\]]?\s*\.`)
+
+// vetQuery runs query, which reads table and returns no rows, only to have
+// the authorizer check it, for a statement that applies every row policy
+// itself through policyScope.
+func (db *DB) vetQuery(op string, table string, query string, args ...interface{}) error {
+	if qualified.MatchString(query) {
+		return db.deny(op, table, "user %q may not qualify table names with a schema", db.user)
+	}
+	return db.raw(op, true, query, args, func(ctx context.Context, conn executor) error {
+		rows, err := conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	})
+}
+
+// vetCondition checks, if db is a session handle, that cond, a condition
+// on the rows of table with arguments args, only reads what the user may
+// select, for a statement that applies every row policy itself.
+func (db *DB) vetCondition(op string, table string, cond string, args []interface{}) error {
+	if db.user == "" {
+		return nil
+	}
+	return db.vetQuery(op, table, "SELECT NULL FROM "+table+" WHERE "+cond+" LIMIT 0", args...)
+}
+
+// rawSavepoint is the savepoint an audited raw query runs under.
+const rawSavepoint = "dorm_raw_audit"
+
+// writes matches statements that may change rows.
+var writes = regexp.MustCompile(`(?i)\b(insert|update|delete|replace)\b`)
+
+// replaces matches statements that replace the rows they conflict with.
+var replaces = regexp.MustCompile(`(?i)\b((insert|update)\s+or\s+replace|replace\s+into)\b`)
+
+// onConflictReplace matches table definitions with a constraint that
+// replaces conflicting rows whenever the table is written.
+var onConflictReplace = regexp.MustCompile(`(?i)\bon\s+conflict\s+replace\b`)
+
+// replacingTables returns the lower case names of the tables whose
+// definitions replace conflicting rows.
+func (db *DB) replacingTables() (map[string]bool, error) {
+	tables := map[string]bool{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var name, def string
+			if err := rows.Scan(&name, &def); err != nil {
+				return err
+			}
+			if onConflictReplace.MatchString(def) {
+				tables[strings.ToLower(name)] = true
+			}
+		}
+		return rows.Err()
+	}, "SELECT name, sql FROM sqlite_master WHERE type = 'table' AND sql LIKE '%replace%'")
+	return tables, err
+}
+
+// raw calls run to issue the raw SQL query, with arguments args, on behalf
+// of operation op, with the authorizer and the audit hooks installed on the
+// connection it is given as needed. If policies is set, the authorizer
+// leaves row policies to the caller.
+func (db *DB) raw(op string, policies bool, query string, args []interface{}, run func(ctx context.Context, conn executor) error) error {
+	if ddl.MatchString(query) {
+		defer db.invalidateSchema()
+	}
+	if db.user == "" && !db.auditing() {
+		ctx, cancel := db.context()
+		defer cancel()
+		return wrapErr(op, "", run(ctx, db.conn))
+	}
+	if db.auditing() && db.tx == nil {
+		return db.audited(func(db *DB) error {
+			return db.raw(op, policies, query, args, run)
+		})
+	}
+
+	var a *rawAuthorizer
+	if db.user != "" {
+		grants, err := db.loadGrants("")
+		if err != nil {
+			return wrapErr(op, "", err)
+		}
+		a = &rawAuthorizer{db: db, grants: grants, policies: policies}
+		if writes.MatchString(query) {
+			a.replaces = replaces.MatchString(query)
+			if a.replace, err = db.replacingTables(); err != nil {
+				return wrapErr(op, "", err)
+			}
+		}
+	}
+
+	ctx, cancel := db.context()
+	defer cancel()
+
+	// the hooks are installed on a single connection, which the query must
+	// then run on: the transaction's, or one reserved from the pool
+	sqlConn := (*sql.Conn)(nil)
+	conn := db.conn
+	if db.tx != nil {
+		sqlConn = db.tx.sqlConn
+	} else {
+		var err error
+		if sqlConn, err = db.inner.Conn(ctx); err != nil {
+			return wrapErr(op, "", err)
+		}
+		defer sqlConn.Close()
+		conn = sqlConn
+	}
+	withConn := func(f func(c *sqlite3.SQLiteConn)) error {
+		return sqlConn.Raw(func(driverConn interface{}) error {
+			c, ok := driverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("dorm: raw queries from session handles and audited raw queries require the sqlite3 driver")
+			}
+			f(c)
+			return nil
+		})
+	}
+
+	// the authorizer vets the user's statements, but not those dorm runs
+	// around them, such as the ones writing the audit log
+	vetted := func(run func() error) error {
+		if a == nil {
+			return run()
+		}
+		if err := withConn(func(c *sqlite3.SQLiteConn) { c.RegisterAuthorizer(a.authorize) }); err != nil {
+			return err
+		}
+		defer withConn(func(c *sqlite3.SQLiteConn) { c.RegisterAuthorizer(nil) })
+		return run()
+	}
+	// failed turns the error of a statement the authorizer refused into
+	// ErrPermissionDenied
+	failed := func(err error) error {
+		if a != nil {
+			if denied := a.err(op); denied != nil {
+				return denied
+			}
+		}
+		return wrapErr(op, "", err)
+	}
+
+	if !db.auditing() {
+		if err := vetted(func() error { return run(ctx, conn) }); err != nil {
+			return failed(err)
+		}
+		return nil
+	}
+
+	changes := &changeRecorder{}
+	if err := withConn(func(c *sqlite3.SQLiteConn) { c.RegisterUpdateHook(changes.record) }); err != nil {
+		return wrapErr(op, "", err)
+	}
+	defer withConn(func(c *sqlite3.SQLiteConn) { c.RegisterUpdateHook(nil) })
+
+	// auditing runs in a transaction, so the query can be rolled back to
+	// this savepoint if its changes cannot be audited
+	if _, err := conn.ExecContext(ctx, "SAVEPOINT "+rawSavepoint); err != nil {
+		return wrapErr(op, "", err)
+	}
+	// errors are reported once the query has been rolled back, so that a
+	// denial recorded in the audit log is not rolled back with it
+	rollback := func() {
+		conn.ExecContext(ctx, "ROLLBACK TO "+rawSavepoint)
+		conn.ExecContext(ctx, "RELEASE "+rawSavepoint)
+	}
+
+	// a trial run of a query that may write, rolled back straight away,
+	// reveals which rows it changes, so that they can be captured before
+	// it is run for real
+	var tried []rowChange
+	if writes.MatchString(query) {
+		err := vetted(func() error {
+			_, err := conn.ExecContext(ctx, query, args...)
+			return err
+		})
+		if _, rbErr := conn.ExecContext(ctx, "ROLLBACK TO "+rawSavepoint); rbErr != nil && err == nil {
+			err = rbErr
+		}
+		if err != nil {
+			rollback()
+			return failed(err)
+		}
+		tried = changes.take()
+	}
+	before, err := db.beforeImages(tried)
+	if err != nil {
+		rollback()
+		return wrapErr(op, "", err)
+	}
+
+	if err := vetted(func() error { return run(ctx, conn) }); err != nil {
+		rollback()
+		return failed(err)
+	}
+	// a query that changes other rows than its trial run did, such as one
+	// that depends on random() or the time, cannot be audited faithfully
+	for _, c := range changes.changes {
+		if _, ok := before[c.rowRef]; !ok {
+			rollback()
+			return newErr(op, c.table, nil, "cannot audit the query: it changed row %d, which its trial run did not", c.rowid)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "RELEASE "+rawSavepoint); err != nil {
+		return wrapErr(op, "", err)
+	}
+	return wrapErr(op, "", changes.audit(db, query, before))
+}
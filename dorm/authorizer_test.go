@@ -0,0 +1,231 @@
+package dorm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestQueryAuthorizerTables(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "SELECT ON user")
+	alice := db.As("alice")
+
+	results := []User{}
+	if err := alice.TryQuery(&results, "select * from user where full_name < 'D'"); err != nil || len(results) != 3 {
+		t.Errorf("Expected 3 users but found %d, %v", len(results), err)
+	}
+
+	// the result model's table is not what decides access
+	results = []User{}
+	err := alice.TryQuery(&results, "select author from post")
+	if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "post") {
+		t.Errorf("Expected ErrPermissionDenied naming post but got %v", err)
+	}
+	err = alice.TryQuery(&results, "select full_name from user where exists (select 1 from post where author = full_name)")
+	if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "post") {
+		t.Errorf("Expected ErrPermissionDenied naming post but got %v", err)
+	}
+
+	counts := []Counter{}
+	if err := alice.TryQuery(&counts, "select count(*) as n from user"); err != nil || counts[0].N != int64(len(MockUsers)) {
+		t.Errorf("Expected a count of %d but found %v, %v", len(MockUsers), counts, err)
+	}
+
+	// the authorizer does not outlive the session's query
+	posts := []Post{}
+	if err := db.TryQuery(&posts, "select * from post"); err != nil || len(posts) != len(MockPosts) {
+		t.Errorf("Expected %d posts but found %d, %v", len(MockPosts), len(posts), err)
+	}
+}
+
+func TestQueryAuthorizerColumns(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, MockUsers3)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("bob", "SELECT(full_name) ON user2")
+	bob := db.As("bob")
+
+	results := []User{}
+	if err := bob.TryQuery(&results, "select full_name from user2"); err != nil || len(results) != 2 {
+		t.Errorf("Expected 2 users but found %d, %v", len(results), err)
+	}
+
+	err := bob.TryQuery(&[]User2{}, "select * from user2")
+	if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "user2.e_mail") {
+		t.Errorf("Expected ErrPermissionDenied naming user2.e_mail but got %v", err)
+	}
+	err = bob.TryQuery(&results, "select full_name from user2 where e_mail like 'f%'")
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+func TestQueryAuthorizerWrites(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "SELECT ON user")
+	alice := db.As("alice")
+
+	for _, stmt := range []string{
+		"delete from user",
+		"insert into user values ('Mallory')",
+		"update user set full_name = 'Mallory'",
+		"drop table user",
+		"insert into dorm_grants values ('alice', 'DELETE', '*', '')",
+	} {
+		if err := alice.TryQuery(&[]User{}, stmt); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected ErrPermissionDenied for %q but got %v", stmt, err)
+		}
+	}
+	if n := countUsers(&db); n != len(MockUsers) {
+		t.Errorf("Expected %d users but found %d", len(MockUsers), n)
+	}
+
+	db.Grant("alice", "DELETE ON user")
+	err := alice.Transaction(func(tx *Tx) error {
+		return tx.TryQuery(&[]User{}, "delete from user where full_name = 'Bob Smith'")
+	})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if n := countUsers(&db); n != len(MockUsers)-1 {
+		t.Errorf("Expected %d users but found %d", len(MockUsers)-1, n)
+	}
+}
+
+func TestQueryAuthorizerInsertColumns(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// sqlite names no columns for an insert, so a grant on some of them
+	// does not cover it
+	db.Grant("bob", "SELECT, INSERT(author) ON post")
+	bob := db.As("bob")
+	if _, err := bob.Exec("insert into post (author, likes) values ('bob', 999)"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	db.Grant("bob", "INSERT ON post")
+	if _, err := bob.Exec("insert into post (author, likes) values ('bob', 1)"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	// replacing a conflicting row deletes it
+	for _, stmt := range []string{
+		"insert or replace into post (id, author) values (2, 'bob')",
+		"replace into post (id, author) values (2, 'bob')",
+		"update or replace post set id = 1 where id = 2",
+	} {
+		if _, err := bob.Exec(stmt); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected ErrPermissionDenied for %q but got %v", stmt, err)
+		}
+	}
+	if _, err := conn.Exec("create table tag (name text unique on conflict replace)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Grant("bob", "INSERT ON tag")
+	if _, err := bob.Exec("insert into tag values ('a')"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied for a table declared on conflict replace but got %v", err)
+	}
+
+	posts := []Post{}
+	db.Find(&posts)
+	if len(posts) != len(MockPosts)+1 || posts[1].Author != "bob" || posts[1].Likes != 12 {
+		t.Errorf("Expected the posts untouched but found %v", postAuthors(posts))
+	}
+
+	db.Grant("bob", "DELETE ON post")
+	if _, err := bob.Exec("insert or replace into post (id, author, likes) values (2, 'bob', 13)"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestQueryAuthorizerSystemTables(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Grant("mallory", "ALL ON *")
+	mallory := db.As("mallory")
+	if _, err := mallory.Exec("insert into user2 (full_name) values ('Mallory')"); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	// ON * does not cover the system tables
+	for _, stmt := range []string{
+		"insert into dorm_grants values ('mallory', 'DELETE', 'user2', '')",
+		"update dorm_grants set privilege = 'DELETE'",
+		"delete from dorm_roles",
+		"select * from dorm_audit",
+		"delete from dorm_audit",
+		"select count(*) from user2 where full_name in (select grantee from dorm_grants)",
+	} {
+		if _, err := mallory.Exec(stmt); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected ErrPermissionDenied for %q but got %v", stmt, err)
+		}
+	}
+
+	// the audit log is still written on mallory's behalf
+	entries, err := db.AuditTrail(&User2{})
+	if err != nil || len(entries) != 1 || entries[0].Operation != AuditInsert {
+		t.Errorf("Expected mallory's insert to be audited but found %v, %v", entries, err)
+	}
+	rows := []grantRow{}
+	if err := db.TryFind(&rows); err != nil || len(rows) != len(allPrivileges) {
+		t.Errorf("Expected mallory's %d grants untouched but found %v, %v", len(allPrivileges), rows, err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "SELECT, DELETE ON user")
+	alice := db.As("alice")
+
+	n, err := alice.Exec("delete from user where full_name = ?", "Bob Smith")
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 row deleted but got %d, %v", n, err)
+	}
+	if _, err := alice.Exec("update user set full_name = 'Mallory'"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	n, err = db.Exec("create table log (line text); insert into log values ('a'), ('b')")
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 rows inserted but got %d, %v", n, err)
+	}
+}
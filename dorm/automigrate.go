@@ -0,0 +1,388 @@
+package dorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Actions reported by AutoMigrate.
+const (
+	MigrateCreateTable  = "CREATE TABLE"
+	MigrateAddColumn    = "ADD COLUMN"
+	MigrateRebuildTable = "REBUILD TABLE"
+	MigrateCreateIndex  = "CREATE INDEX"
+)
+
+// A SchemaChange describes one change AutoMigrate made to the database.
+type SchemaChange struct {
+	Table  string
+	Action string // one of the Migrate constants
+	Column string // the column or index added, or "" for a whole table
+	Detail string // the column or index definition, or why the table was rebuilt
+}
+
+func (c SchemaChange) String() string {
+	if c.Column != "" {
+		return fmt.Sprintf("%v %v %v %v", c.Table, c.Action, c.Column, c.Detail)
+	}
+	return fmt.Sprintf("%v %v: %v", c.Table, c.Action, c.Detail)
+}
+
+// MigrateOption configures AutoMigrate.
+type MigrateOption func(*migrateOptions)
+
+type migrateOptions struct {
+	rebuild bool
+}
+
+// AllowRebuild lets AutoMigrate rebuild a table whose columns cannot be
+// brought in line with its model by adding columns: when a column has been
+// dropped from the model or changed to an incompatible type, or when the
+// primary key or a unique column is missing. Without it such differences
+// are left as they are. Columns in another order than the fields are fine,
+// since rows are read by column name.
+func AllowRebuild() MigrateOption {
+	return func(o *migrateOptions) { o.rebuild = true }
+}
+
+// column is a column of a live table, as reported by PRAGMA table_info.
+type column struct {
+	name    string
+	typ     string
+	primary bool
+}
+
+// AutoMigrate brings the table of each model in line with the model's
+// fields. It creates missing tables, columns and indexes, and, if
+// AllowRebuild is among the arguments, rebuilds tables whose existing
+// columns differ from the model using SQLite's copy-and-rename procedure,
+// keeping the data of the columns the model still has. All changes are
+// made in one transaction, and are returned in the order they were made.
+// Only unrestricted handles may migrate. Foreign key enforcement is turned
+// off while tables may be rebuilt, so that dropping the old table does not
+// cascade to the rows referring to it; sqlite cannot turn it off inside a
+// transaction, so a db that is one cannot rebuild tables while it is on.
+
+// Example usage:
+//    changes, err := db.AutoMigrate(&Post{}, &User{}, dorm.AllowRebuild())
+//    for _, c := range changes {
+//        log.Println(c)
+//    }
+func (db *DB) AutoMigrate(models ...interface{}) ([]SchemaChange, error) {
+	opts := migrateOptions{}
+	tables := []interface{}{}
+	for _, m := range models {
+		if opt, ok := m.(MigrateOption); ok {
+			opt(&opts)
+		} else {
+			tables = append(tables, m)
+		}
+	}
+
+	var prepare func(ctx context.Context, conn *sql.Conn) (func(), error)
+	if opts.rebuild {
+		prepare = foreignKeysOff
+	}
+	changes := []SchemaChange{}
+	err := db.transaction(prepare, func(tx *Tx) error {
+		for _, model := range tables {
+			c, err := tx.migrate(model, opts)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, c...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// migrate brings the table of model, and its indexes, in line with its
+// fields.
+func (db *DB) migrate(model interface{}, opts migrateOptions) ([]SchemaChange, error) {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	if err := checkFields("AutoMigrate", name, t); err != nil {
+		return nil, err
+	}
+	if err := db.requireAdmin("AutoMigrate", name); err != nil {
+		return nil, err
+	}
+	defer db.invalidateSchema()
+
+	changes, err := db.migrateColumns(name, t, opts)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := db.migrateIndexes(name, t)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, indexes...), nil
+}
+
+// migrateColumns brings the columns of table in line with the fields of
+// the struct type t.
+func (db *DB) migrateColumns(name string, t reflect.Type, opts migrateOptions) ([]SchemaChange, error) {
+	live, err := db.tableColumns(name)
+	if err != nil {
+		return nil, wrapErr("AutoMigrate", name, err)
+	}
+	if len(live) == 0 {
+		if _, err := db.exec(db.createTableSQL(name, t)); err != nil {
+			return nil, wrapErr("AutoMigrate", name, err)
+		}
+		return []SchemaChange{{Table: name, Action: MigrateCreateTable, Detail: strings.Join(db.columnDefinitions(t), ", ")}}, nil
+	}
+
+	liveByName := map[string]column{}
+	for _, col := range live {
+		liveByName[col.name] = col
+	}
+	info := typeOf(t)
+	wanted := map[string]bool{}
+	missing := []int{}
+	reasons := []string{}
+	for _, i := range info.fields {
+		f := t.Field(i)
+		col := db.columnName(t, i)
+		wanted[col] = true
+		existing, ok := liveByName[col]
+		switch {
+		case !ok && i == info.pk:
+			reasons = append(reasons, "primary key "+col+" is missing")
+		case !ok && hasOption(f, "unique"):
+			// sqlite cannot add a UNIQUE column
+			reasons = append(reasons, "unique column "+col+" is missing")
+		case !ok:
+			missing = append(missing, i)
+		case (i == info.pk) != existing.primary:
+			reasons = append(reasons, "primary key of "+col+" changed")
+		case !compatibleType(f.Type, existing.typ):
+			reasons = append(reasons, fmt.Sprintf("column %v has type %v, not %v", col, existing.typ, f.Type))
+		}
+	}
+	for _, col := range live {
+		if !wanted[col.name] {
+			reasons = append(reasons, "column "+col.name+" was dropped")
+		}
+	}
+
+	if len(reasons) > 0 && opts.rebuild {
+		dropped, err := db.rebuildTable(name, t, live)
+		if err != nil {
+			return nil, wrapErr("AutoMigrate", name, err)
+		}
+		for _, obj := range dropped {
+			reasons = append(reasons, obj+" was dropped with its columns")
+		}
+		return []SchemaChange{{Table: name, Action: MigrateRebuildTable, Detail: strings.Join(reasons, "; ")}}, nil
+	}
+
+	changes := []SchemaChange{}
+	for _, i := range missing {
+		def := db.columnDefinition(t, i)
+		if _, err := db.exec("ALTER TABLE " + name + " ADD COLUMN " + def); err != nil {
+			return nil, wrapErr("AutoMigrate", name, err)
+		}
+		col := db.columnName(t, i)
+		changes = append(changes, SchemaChange{Table: name, Action: MigrateAddColumn, Column: col, Detail: strings.TrimPrefix(def, col+" ")})
+	}
+	return changes, nil
+}
+
+// tableColumns returns the columns of table in order, or none if there is
+// no such table.
+func (db *DB) tableColumns(table string) ([]column, error) {
+	cols := []column{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var cid, notNull, pk int
+			var dflt interface{}
+			col := column{}
+			if err := rows.Scan(&cid, &col.name, &col.typ, &notNull, &dflt, &pk); err != nil {
+				return err
+			}
+			col.primary = pk > 0
+			cols = append(cols, col)
+		}
+		return rows.Err()
+	}, "PRAGMA table_info("+table+")")
+	return cols, err
+}
+
+// foreignKeysOff turns off foreign key enforcement on conn, if it is on,
+// and returns the function that turns it back on.
+func foreignKeysOff(ctx context.Context, conn *sql.Conn) (func(), error) {
+	var on bool
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&on); err != nil {
+		return nil, err
+	}
+	if !on {
+		return func() {}, nil
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return nil, err
+	}
+	return func() { conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON") }, nil
+}
+
+// pragma returns the value of the integer PRAGMA name.
+func (db *DB) pragma(name string) (int, error) {
+	value := 0
+	err := db.query(func(rows *sql.Rows) error {
+		if !rows.Next() {
+			return rows.Err()
+		}
+		return rows.Scan(&value)
+	}, "PRAGMA "+name)
+	return value, err
+}
+
+// schemaObject is an index or trigger of a table, as recorded in
+// sqlite_master.
+type schemaObject struct {
+	typ  string
+	name string
+	sql  string
+}
+
+// rebuildTable recreates table with the columns of the struct type t,
+// copying over the data of the columns it shares with live, following
+// SQLite's copy-and-rename procedure. It restores the table's indexes and
+// triggers, except those that refer to a column the table no longer has,
+// which it returns as "index <name>" or "trigger <name>". Views that refer
+// to the table refer to the new table afterwards.
+func (db *DB) rebuildTable(table string, t reflect.Type, live []column) ([]string, error) {
+	// dropping the old table would delete the rows referring to it
+	foreignKeys, err := db.pragma("foreign_keys")
+	if err != nil {
+		return nil, err
+	}
+	if foreignKeys != 0 {
+		return nil, newErr("AutoMigrate", table, nil, "cannot rebuild the table inside a transaction with foreign keys enforced")
+	}
+	legacy, err := db.pragma("legacy_alter_table")
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []schemaObject{}
+	err = db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			obj := schemaObject{}
+			if err := rows.Scan(&obj.typ, &obj.name, &obj.sql); err != nil {
+				return err
+			}
+			objects = append(objects, obj)
+		}
+		return rows.Err()
+	}, "SELECT type, name, sql FROM sqlite_master WHERE tbl_name = ? AND type IN ('index', 'trigger') AND sql IS NOT NULL", table)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, col := range db.columnNames(t) {
+		wanted[col] = true
+	}
+	shared := []string{}
+	gone := []string{}
+	for _, col := range live {
+		if wanted[col.name] {
+			shared = append(shared, col.name)
+		} else {
+			gone = append(gone, regexp.QuoteMeta(col.name))
+		}
+	}
+
+	restore := []string{}
+	dropped := []string{}
+	refersToGone := regexp.MustCompile(`(?i)\b(` + strings.Join(gone, "|") + `)\b`)
+	for _, obj := range objects {
+		if len(gone) > 0 && refersToGone.MatchString(obj.sql) {
+			dropped = append(dropped, obj.typ+" "+obj.name)
+			continue
+		}
+		restore = append(restore, obj.sql)
+	}
+
+	tmp := "dorm_new_" + table
+	cols := strings.Join(shared, ", ")
+	stmts := []string{
+		db.createTableSQL(tmp, t),
+		fmt.Sprintf("INSERT INTO %v (%v) SELECT %v FROM %v", tmp, cols, cols, table),
+		"DROP TABLE " + table,
+		// the legacy rename leaves views that refer to the table alone,
+		// rather than failing because the table is missing
+		"PRAGMA legacy_alter_table = ON",
+		"ALTER TABLE " + tmp + " RENAME TO " + table,
+		fmt.Sprintf("PRAGMA legacy_alter_table = %d", legacy),
+	}
+	for _, stmt := range append(stmts, restore...) {
+		if _, err := db.exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	// rows of other tables may refer to keys the table no longer has
+	violations := 0
+	err = db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			if err := rows.Scan(&violations); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}, "SELECT count(*) FROM pragma_foreign_key_check WHERE \"table\" = ? OR parent = ?", table, table)
+	if err != nil {
+		return nil, err
+	}
+	if violations > 0 {
+		return nil, newErr("AutoMigrate", table, ErrConstraintViolation, "rebuilt table violates %d foreign key constraints", violations)
+	}
+	return dropped, nil
+}
+
+// affinity returns the SQLite type affinity of a declared column type.
+func affinity(declared string) string {
+	d := strings.ToUpper(declared)
+	switch {
+	case strings.Contains(d, "INT"):
+		return "INTEGER"
+	case strings.Contains(d, "CHAR"), strings.Contains(d, "CLOB"), strings.Contains(d, "TEXT"):
+		return "TEXT"
+	case d == "", strings.Contains(d, "BLOB"):
+		return "BLOB"
+	case strings.Contains(d, "REAL"), strings.Contains(d, "FLOA"), strings.Contains(d, "DOUB"):
+		return "REAL"
+	}
+	return "NUMERIC"
+}
+
+// compatibleType reports whether a column declared as declared can hold
+// values of the Go type ft without losing them.
+func compatibleType(ft reflect.Type, declared string) bool {
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	a := affinity(declared)
+	switch ft.Kind() {
+	case reflect.String:
+		return a == "TEXT" || a == "BLOB"
+	case reflect.Float32, reflect.Float64:
+		return a == "REAL" || a == "NUMERIC" || a == "BLOB"
+	case reflect.Slice:
+		return a == "BLOB" || a == "TEXT"
+	case reflect.Struct:
+		return a != "INTEGER" && a != "REAL"
+	}
+	return a == "INTEGER" || a == "NUMERIC" || a == "BLOB"
+}
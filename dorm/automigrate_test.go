@@ -0,0 +1,222 @@
+package dorm
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func schemaActions(changes []SchemaChange) []string {
+	actions := []string{}
+	for _, c := range changes {
+		actions = append(actions, c.Table+" "+c.Action+" "+c.Column)
+	}
+	return actions
+}
+
+func TestAutoMigrateCreatesAndAdds(t *testing.T) {
+	conn := connectSQL()
+	_, err := conn.Exec(`create table post (
+		id integer primary key autoincrement,
+		author text
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`insert into post (author) values ('alice')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	changes, err := db.AutoMigrate(&Post{}, &User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"post ADD COLUMN likes", "user CREATE TABLE "}
+	if !reflect.DeepEqual(schemaActions(changes), expected) {
+		t.Errorf("Expected %v but found %v", expected, changes)
+	}
+
+	// the existing row reads back with the zero value of the new field
+	post := &Post{}
+	if err := db.TryFirst(post); err != nil || *post != (Post{ID: 1, Author: "alice"}) {
+		t.Errorf("Expected alice's post but found %v, %v", *post, err)
+	}
+	db.Create(&User{FullName: "Frelicia"})
+	users := []User{}
+	db.Find(&users)
+	if len(users) != 1 {
+		t.Errorf("Expected 1 user but found %d", len(users))
+	}
+
+	// a second run has nothing to do
+	changes, err = db.AutoMigrate(&Post{}, &User{})
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes but found %v, %v", changes, err)
+	}
+}
+
+func TestAutoMigrateRebuild(t *testing.T) {
+	conn := connectSQL()
+	_, err := conn.Exec(`create table post (
+		id integer primary key autoincrement,
+		body text,
+		author text,
+		likes text
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`create index post_author on post (author)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`insert into post (body, author, likes) values ('hi', 'alice', '5'), ('yo', 'bob', '12')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// without AllowRebuild the table is left alone
+	changes, err := db.AutoMigrate(&Post{})
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes but found %v, %v", changes, err)
+	}
+
+	changes, err = db.AutoMigrate(&Post{}, AllowRebuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"post REBUILD TABLE "}
+	if !reflect.DeepEqual(schemaActions(changes), expected) {
+		t.Errorf("Expected %v but found %v", expected, changes)
+	}
+
+	results := []Post{}
+	if err := db.TryFind(&results); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(postAuthors(results), []string{"alice:5", "bob:12"}) {
+		t.Errorf("Expected the posts to survive the rebuild but found %v", postAuthors(results))
+	}
+
+	cols, err := db.tableColumns("post")
+	if err != nil || len(cols) != 3 || cols[2].typ != "INTEGER" {
+		t.Errorf("Expected columns id, author, likes INTEGER but found %v, %v", cols, err)
+	}
+	indexes := []Counter{}
+	db.Query(&indexes, "select count(*) as n from sqlite_master where type = 'index' and name = 'post_author'")
+	if indexes[0].N != 1 {
+		t.Errorf("Expected the index to be restored")
+	}
+}
+
+func TestAutoMigrateRebuildDependents(t *testing.T) {
+	conn, err := sql.Open("sqlite3", "file:test.db?mode=memory&_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`create table post (id integer primary key autoincrement, body text, author text, likes text)`,
+		`create table comment (id integer primary key, post_id integer references post (id) on delete cascade)`,
+		`create view popular as select author from post where likes > 10`,
+		`create index post_body on post (body)`,
+		`create index post_author on post (author)`,
+		`insert into post (body, author, likes) values ('hi', 'alice', '5'), ('yo', 'bob', '12')`,
+		`insert into comment (post_id) values (1), (2)`,
+	} {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// foreign keys cannot be turned off inside a transaction
+	err = db.Transaction(func(tx *Tx) error {
+		_, err := tx.AutoMigrate(&Post{}, AllowRebuild())
+		return err
+	})
+	if err == nil {
+		t.Errorf("Expected an error rebuilding inside a transaction")
+	}
+
+	changes, err := db.AutoMigrate(&Post{}, AllowRebuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !strings.Contains(changes[0].Detail, "index post_body was dropped") {
+		t.Errorf("Expected the index on body to be dropped but found %v", changes)
+	}
+
+	// the comments on the old table are not deleted with it
+	counts := []Counter{}
+	db.Query(&counts, "select count(*) as n from comment")
+	if counts[0].N != 2 {
+		t.Errorf("Expected 2 comments but found %d", counts[0].N)
+	}
+	authors := []User{}
+	if err := db.TryQuery(&authors, "select author as full_name from popular"); err != nil || len(authors) != 1 {
+		t.Errorf("Expected the view to find bob but found %v, %v", authors, err)
+	}
+	indexes := []Counter{}
+	db.Query(&indexes, "select count(*) as n from sqlite_master where type = 'index' and name like 'post_%'")
+	if indexes[0].N != 1 {
+		t.Errorf("Expected only the index on author restored but found %d", indexes[0].N)
+	}
+
+	// enforcement is back on afterwards
+	if _, err := conn.Exec("insert into comment (post_id) values (99)"); err == nil {
+		t.Errorf("Expected foreign keys to be enforced again")
+	}
+}
+
+func TestAutoMigrateColumnOrder(t *testing.T) {
+	conn := connectSQL()
+	_, err := conn.Exec(`create table post (
+		likes integer,
+		author text,
+		id integer primary key autoincrement
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`insert into post (author, likes) values ('alice', 5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// rows are read by column name, so the order does not matter
+	changes, err := db.AutoMigrate(&Post{}, AllowRebuild())
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes but found %v, %v", changes, err)
+	}
+	results := []Post{}
+	if err := db.TryFind(&results); err != nil || !reflect.DeepEqual(postAuthors(results), []string{"alice:5"}) {
+		t.Errorf("Expected alice's post but found %v, %v", results, err)
+	}
+}
+
+func TestAutoMigratePermission(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "ALL")
+	if _, err := db.As("alice").AutoMigrate(&Post{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+)
+
+// CreateMany inserts every model in models, a pointer to a slice of models
+// or a slice of pointers to models, with as few multi-row INSERT statements
+// as SQLite's limit on bound parameters allows. The rows are inserted in
+// one transaction, so either all of them are created or none are, and the
+// field tagged `dorm:"primary_key"` of each model is back-filled with its
+// row's ID, as Create does. It returns ErrTableNotFound if the models'
+// table does not exist.
+
+// Example usage:
+//    posts := []Post{{Author: "alice"}, {Author: "bob"}}
+//    err := db.CreateMany(&posts)
+//    // posts[0].ID, posts[1].ID are set
+func (db *DB) CreateMany(models interface{}) error {
+	return db.createMany("CreateMany", models, 0)
+}
+
+// CreateInBatches is like CreateMany, but inserts at most batchSize rows
+// with each statement.
+
+// Example usage:
+//    err := db.CreateInBatches(&posts, 500)
+func (db *DB) CreateInBatches(models interface{}, batchSize int) error {
+	if batchSize <= 0 {
+		return newErr("CreateInBatches", "", nil, "batch size %d is not positive", batchSize)
+	}
+	return db.createMany("CreateInBatches", models, batchSize)
+}
+
+// createMany does the work of CreateMany and CreateInBatches; a batchSize
+// of 0 puts no limit on the rows in a statement.
+func (db *DB) createMany(op string, models interface{}, batchSize int) error {
+	t, rows, err := modelValues(models)
+	if err != nil {
+		return newErr(op, "", nil, "%v", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if batchSize == 0 {
+		batchSize = len(rows)
+	}
+	name := db.tableName(reflect.New(t).Interface())
+	return db.audited(func(db *DB) error {
+		return db.Transaction(func(tx *Tx) error {
+			return tx.insert(op, name, t, rows, batchSize)
+		})
+	})
+}
+
+// modelValues returns the struct type of the models in models, a pointer
+// to a slice of structs or a slice of pointers to structs, and addressable
+// values of the models themselves.
+func modelValues(models interface{}) (reflect.Type, []reflect.Value, error) {
+	v := reflect.ValueOf(models)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice && v.Elem().Type().Elem().Kind() == reflect.Struct {
+		v = v.Elem()
+		rows := make([]reflect.Value, v.Len())
+		for i := range rows {
+			rows[i] = v.Index(i)
+		}
+		return v.Type().Elem(), rows, nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Ptr && v.Type().Elem().Elem().Kind() == reflect.Struct {
+		rows := make([]reflect.Value, v.Len())
+		for i := range rows {
+			if v.Index(i).IsNil() {
+				return nil, nil, errors.New("nil model in slice")
+			}
+			rows[i] = v.Index(i).Elem()
+		}
+		return v.Type().Elem().Elem(), rows, nil
+	}
+	return nil, nil, errors.New("models must be a pointer to a slice of structs or a slice of pointers to structs")
+}
@@ -0,0 +1,93 @@
+package dorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCreateMany(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// more rows than fit in one statement
+	posts := make([]Post, 1200)
+	for i := range posts {
+		posts[i] = Post{Author: fmt.Sprintf("author%d", i), Likes: i}
+	}
+	if err := db.CreateMany(&posts); err != nil {
+		t.Fatal(err)
+	}
+
+	results := []Post{}
+	db.Find(&results)
+	if len(results) != len(MockPosts)+len(posts) {
+		t.Fatalf("Expected %d posts but found %d", len(MockPosts)+len(posts), len(results))
+	}
+	byID := map[int64]Post{}
+	for _, p := range results {
+		byID[p.ID] = p
+	}
+	for _, p := range posts {
+		if byID[p.ID] != p {
+			t.Fatalf("Expected post %d to be %v but found %v", p.ID, p, byID[p.ID])
+		}
+	}
+
+	if err := db.CreateMany(&[]Post{}); err != nil {
+		t.Errorf("Expected no error for no posts but got %v", err)
+	}
+	if err := db.CreateMany(Post{}); err == nil {
+		t.Errorf("Expected an error for a model that is not a slice")
+	}
+}
+
+func TestCreateInBatches(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Account{})
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := []*Account{{Handle: "alice"}, {Handle: "bob"}, {Handle: "carol"}}
+	if err := db.CreateInBatches(accounts, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range accounts {
+		if a.ID != int64(i+1) {
+			t.Errorf("Expected %v to have ID %d but found %d", a.Handle, i+1, a.ID)
+		}
+	}
+	entries, err := db.AuditTrail(&Account{})
+	if err != nil || len(entries) != 3 {
+		t.Errorf("Expected 3 audit entries but found %v, %v", entries, err)
+	}
+
+	// a row that fails its constraints rolls back the whole call
+	more := []Account{{Handle: "dave"}, {Handle: "erin", Karma: -1}}
+	if err := db.CreateInBatches(&more, 1); !errors.Is(err, ErrConstraintViolation) {
+		t.Errorf("Expected ErrConstraintViolation but got %v", err)
+	}
+	results := []Account{}
+	db.Find(&results)
+	if len(results) != 3 {
+		t.Errorf("Expected 3 accounts but found %d", len(results))
+	}
+
+	if err := db.CreateInBatches(&more, 0); err == nil {
+		t.Errorf("Expected an error for a batch size of 0")
+	}
+	db.Grant("alice", "SELECT ON account")
+	if err := db.As("alice").CreateMany(&more); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package dorm
+
+import (
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The Uncached benchmarks repeat the work the model registry and schema
+// cache save, for comparison.
+
+func BenchmarkColumnNames(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ColumnNames(&Account{})
+	}
+}
+
+func BenchmarkColumnNamesUncached(b *testing.B) {
+	t := reflect.TypeOf(Account{})
+	for i := 0; i < b.N; i++ {
+		cols := []string{}
+		for j := 0; j < t.NumField(); j++ {
+			if f := t.Field(j); f.IsExported() && !hasOption(f, "-") {
+				cols = append(cols, columnNameWith(defaultNaming, f))
+			}
+		}
+	}
+}
+
+func BenchmarkCreate(b *testing.B) {
+	conn := connectSQL()
+	createPostTable(conn)
+	db := NewDB(conn)
+	defer db.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Create(&Post{Author: "alice", Likes: i})
+	}
+}
+
+func BenchmarkCreateUncached(b *testing.B) {
+	conn := connectSQL()
+	createPostTable(conn)
+	db := NewDB(conn)
+	defer db.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.invalidateSchema()
+		db.Create(&Post{Author: "alice", Likes: i})
+	}
+}
+
+func BenchmarkFind(b *testing.B) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+	db := NewDB(conn)
+	defer db.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Find(&[]Post{})
+	}
+}
+
+func BenchmarkCreateInBatches(b *testing.B) {
+	conn := connectSQL()
+	createPostTable(conn)
+	db := NewDB(conn)
+	defer db.Close()
+
+	posts := make([]Post, b.N)
+	for i := range posts {
+		posts[i] = Post{Author: "alice", Likes: i}
+	}
+	b.ResetTimer()
+	if err := db.CreateInBatches(&posts, 500); err != nil {
+		b.Fatal(err)
+	}
+}
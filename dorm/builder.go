@@ -0,0 +1,197 @@
+package dorm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// QueryBuilder composes a parameterized SELECT statement one clause at a
+// time. Obtain one with DB.Model; every method returns a new builder, so a
+// partially built query can be reused as the base of several others.
+
+// Example usage:
+//    posts := []Post{}
+//    err := db.Model(&Post{}).Where("likes > ?", 10).Order("posted DESC").
+//        Limit(20).Offset(40).Find(&posts)
+type QueryBuilder struct {
+	db     *DB
+	table  string
+	scope  clause // leaves out soft-deleted rows, unless cond is ""
+	where  []clause
+	order  []string
+	limit  int
+	offset int
+}
+
+// clause is a single WHERE condition, joined to the conditions before it
+// with conj ("AND" or "OR").
+type clause struct {
+	conj string
+	cond string
+	args []interface{}
+}
+
+// Model starts a query against the table for model, which must be a
+// pointer to a struct. Soft-deleted rows are left out unless db is
+// Unscoped.
+func (db *DB) Model(model interface{}) *QueryBuilder {
+	q := &QueryBuilder{db: db, table: db.tableName(model), limit: -1}
+	q.scope.cond, q.scope.args = db.softDeleteScope(reflect.TypeOf(model).Elem())
+	return q
+}
+
+// clone returns a copy of q that shares no slices with it.
+func (q *QueryBuilder) clone() *QueryBuilder {
+	c := *q
+	c.where = append([]clause(nil), q.where...)
+	c.order = append([]string(nil), q.order...)
+	return &c
+}
+
+// Where adds a condition to the query, ANDed with any previous conditions.
+// cond may contain `?` placeholders, which are bound to args in order.
+func (q *QueryBuilder) Where(cond string, args ...interface{}) *QueryBuilder {
+	c := q.clone()
+	c.where = append(c.where, clause{conj: "AND", cond: cond, args: args})
+	return c
+}
+
+// Or adds a condition to the query, ORed with the previous conditions.
+func (q *QueryBuilder) Or(cond string, args ...interface{}) *QueryBuilder {
+	c := q.clone()
+	c.where = append(c.where, clause{conj: "OR", cond: cond, args: args})
+	return c
+}
+
+// Order adds an ORDER BY term, e.g. "posted DESC". Terms are applied in the
+// order they are added.
+func (q *QueryBuilder) Order(order string) *QueryBuilder {
+	c := q.clone()
+	c.order = append(c.order, order)
+	return c
+}
+
+// Limit caps the number of rows returned at n. A negative n removes the cap.
+func (q *QueryBuilder) Limit(n int) *QueryBuilder {
+	c := q.clone()
+	c.limit = n
+	return c
+}
+
+// Offset skips the first n rows of the result.
+func (q *QueryBuilder) Offset(n int) *QueryBuilder {
+	c := q.clone()
+	c.offset = n
+	return c
+}
+
+// build returns the SELECT statement described by q and its arguments.
+func (q *QueryBuilder) build() (string, []interface{}) {
+	// the row policies apply to every table the conditions read, the
+	// query's own included
+	scope, args := q.db.policyScope()
+	query := scope + "SELECT * FROM " + q.table
+
+	where, whereArgs := q.conditions()
+	args = append(args, whereArgs...)
+	if q.scope.cond != "" {
+		if where != "" {
+			where = "(" + where + ") AND "
+		}
+		where += q.scope.cond
+		args = append(args, q.scope.args...)
+	}
+	if where != "" {
+		query += " WHERE " + where
+	}
+	if len(q.order) > 0 {
+		query += " ORDER BY " + strings.Join(q.order, ", ")
+	}
+	// sqlite only accepts OFFSET after a LIMIT; -1 means no limit.
+	if q.limit >= 0 || q.offset > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.limit)
+	}
+	if q.offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", q.offset)
+	}
+	return query, args
+}
+
+// conditions returns the conditions added by Where and Or, joined into one,
+// and their arguments, or "" if there are none.
+func (q *QueryBuilder) conditions() (string, []interface{}) {
+	conds := []string{}
+	args := []interface{}{}
+	for i, w := range q.where {
+		if i > 0 {
+			conds = append(conds, w.conj)
+		}
+		conds = append(conds, "("+w.cond+")")
+		args = append(args, w.args...)
+	}
+	return strings.Join(conds, " "), args
+}
+
+// vet returns ErrPermissionDenied if q belongs to a session handle and its
+// conditions or ordering read a table or column the user may not select:
+// matching or sorting on a masked column would reveal its values. The
+// clauses are checked by the sqlite authorizer, as raw queries are.
+func (q *QueryBuilder) vet(op string) error {
+	if q.db.user == "" || (len(q.where) == 0 && len(q.order) == 0) {
+		return nil
+	}
+	query := "SELECT NULL FROM " + q.table
+	where, args := q.conditions()
+	if where != "" {
+		query += " WHERE " + where
+	}
+	if len(q.order) > 0 {
+		query += " ORDER BY " + strings.Join(q.order, ", ")
+	}
+	return q.db.vetQuery(op, q.table, query+" LIMIT 0", args...)
+}
+
+// Find runs the query and stores all matching rows in result, which must be
+// a pointer to a slice of models.
+func (q *QueryBuilder) Find(result interface{}) error {
+	return q.find("Find", result)
+}
+
+// find implements Find, reporting errors as coming from operation op.
+func (q *QueryBuilder) find(op string, result interface{}) error {
+	grants, err := q.db.authorize(op, PrivSelect, q.table)
+	if err != nil {
+		return err
+	}
+	if err := q.vet(op); err != nil {
+		return err
+	}
+	query, args := q.build()
+	from := reflect.ValueOf(result).Elem().Len()
+	err = q.db.query(func(rows *sql.Rows) error {
+		return q.db.writeRows(op, rows, result)
+	}, query, args...)
+	q.db.maskRows(grants, q.table, result, from)
+	return wrapErr(op, q.table, err)
+}
+
+// First runs the query and stores the first matching row in result, which
+// must be a pointer to a model. It returns ErrNoRows if no row matches.
+func (q *QueryBuilder) First(result interface{}) error {
+	return q.first("First", result)
+}
+
+// first implements First, reporting errors as coming from operation op.
+func (q *QueryBuilder) first(op string, result interface{}) error {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(result).Elem()))
+	if err := q.Limit(1).find(op, rows.Interface()); err != nil {
+		return err
+	}
+	if rows.Elem().Len() == 0 {
+		return &Error{Op: op, Table: q.table, Kind: ErrNoRows}
+	}
+	reflect.ValueOf(result).Elem().Set(rows.Elem().Index(0))
+	return nil
+}
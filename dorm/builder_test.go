@@ -0,0 +1,251 @@
+package dorm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Post struct {
+	ID     int64 `dorm:"primary_key"`
+	Author string
+	Likes  int
+}
+
+func createPostTable(conn *sql.DB) {
+	_, err := conn.Exec(`create table post (
+		id integer primary key autoincrement,
+		author text,
+		likes integer
+	)`)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func insertPosts(conn *sql.DB, posts []Post) {
+	for _, p := range posts {
+		_, err := conn.Exec(`insert into post (author, likes)
+		values
+		(?,?)`, p.Author, p.Likes)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+var MockPosts = []Post{
+	Post{Author: "alice", Likes: 5},
+	Post{Author: "bob", Likes: 12},
+	Post{Author: "alice", Likes: 30},
+	Post{Author: "carol", Likes: 0},
+	Post{Author: "bob", Likes: 18},
+}
+
+func postAuthors(posts []Post) []string {
+	authors := []string{}
+	for _, p := range posts {
+		authors = append(authors, fmt.Sprintf("%v:%v", p.Author, p.Likes))
+	}
+	return authors
+}
+
+func TestModelWhereOrderLimitOffset(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	results := []Post{}
+	err := db.Model(&Post{}).Where("likes > ?", 4).Order("likes DESC").Limit(2).Offset(1).Find(&results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"bob:18", "bob:12"}
+	if !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v", expected, postAuthors(results))
+	}
+}
+
+func TestModelWhereOr(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	results := []Post{}
+	err := db.Model(&Post{}).Where("author = ?", "alice").Where("likes > ?", 10).Or("author = ?", "carol").Order("id").Find(&results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"alice:30", "carol:0"}
+	if !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v", expected, postAuthors(results))
+	}
+}
+
+// Check that builders can be reused without the derived queries interfering
+func TestModelReuse(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	base := db.Model(&Post{}).Where("author = ?", "bob")
+	popular := []Post{}
+	if err := base.Where("likes > ?", 15).Find(&popular); err != nil {
+		t.Fatal(err)
+	}
+	all := []Post{}
+	if err := base.Order("likes").Find(&all); err != nil {
+		t.Fatal(err)
+	}
+	if len(popular) != 1 || len(all) != 2 {
+		t.Errorf("Expected 1 and 2 posts but found %d and %d", len(popular), len(all))
+	}
+
+	// OFFSET without LIMIT
+	rest := []Post{}
+	if err := db.Model(&Post{}).Offset(3).Find(&rest); err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 2 {
+		t.Errorf("Expected 2 posts but found %d", len(rest))
+	}
+}
+
+func TestModelFirst(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	result := &Post{}
+	if err := db.Model(&Post{}).Where("author = ?", "bob").Order("likes DESC").First(result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Author != "bob" || result.Likes != 18 || result.ID != 5 {
+		t.Errorf("Expected bob's most liked post but found %v", *result)
+	}
+
+	// bound arguments are never interpreted as SQL
+	err := db.Model(&Post{}).Where("author = ?", "x' OR '1'='1").First(result)
+	if !errors.Is(err, ErrNoRows) {
+		t.Errorf("Expected ErrNoRows but got %v", err)
+	}
+}
+
+func TestColumnsMappedByName(t *testing.T) {
+	conn := connectSQL()
+	_, err := conn.Exec(`create table post (
+		likes integer,
+		author text,
+		id integer primary key autoincrement
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// the columns are not in field order
+	for _, p := range MockPosts[:3] {
+		db.Create(&p)
+	}
+	results := []Post{}
+	db.Find(&results)
+	if !reflect.DeepEqual(postAuthors(results), []string{"alice:5", "bob:12", "alice:30"}) || results[2].ID != 3 {
+		t.Errorf("Expected the posts in field order but found %v", results)
+	}
+
+	// a partial, reordered select list leaves the other fields zero
+	results = []Post{}
+	if err := db.TryQuery(&results, "select author, likes from post where likes > 10"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []Post{{Author: "bob", Likes: 12}, {Author: "alice", Likes: 30}}) {
+		t.Errorf("Expected bob's and alice's posts without ids but found %v", results)
+	}
+
+	// unknown columns are ignored, unless the handle is strict
+	results = []Post{}
+	if err := db.TryQuery(&results, "select *, 1 as extra from post"); err != nil || len(results) != 3 {
+		t.Errorf("Expected 3 posts but found %v, %v", results, err)
+	}
+	db.SetStrictColumns(true)
+	if err := db.TryQuery(&results, "select *, 1 as extra from post"); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("Expected ErrUnknownColumn but got %v", err)
+	}
+	// nor are fields without a column when creating
+	type Entry struct {
+		Likes int
+		Title string
+	}
+	if err := db.RenameTable(&Post{}, &Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TryCreate(&Entry{Likes: 1, Title: "hi"}); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("Expected ErrUnknownColumn but got %v", err)
+	}
+}
+
+func TestNullColumnsReadAsZero(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	createPostTable(conn)
+	if _, err := conn.Exec("insert into user2 (full_name) values ('Frelicia')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("insert into post (author) values (null)"); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	users := []User2{}
+	if err := db.TryFind(&users); err != nil || !reflect.DeepEqual(users, []User2{{FullName: "Frelicia"}}) {
+		t.Errorf("Expected Frelicia without an e-mail but found %v, %v", users, err)
+	}
+	posts := []Post{}
+	if err := db.TryFind(&posts); err != nil || !reflect.DeepEqual(posts, []Post{{ID: 1}}) {
+		t.Errorf("Expected an empty post but found %v, %v", posts, err)
+	}
+	// a pointer field reads a NULL as nil
+	notes := []Note{}
+	db.CreateTable(&Note{})
+	db.Create(&Note{Text: "hi"})
+	if err := db.TryFind(&notes); err != nil || len(notes) != 1 || notes[0].DeletedAt != nil {
+		t.Errorf("Expected a note without DeletedAt but found %v, %v", notes, err)
+	}
+}
+
+func TestUnexportedFieldsSkipped(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, MockUsers3)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	results := []User2{}
+	db.Query(&results, "select e_mail, full_name from user2")
+	if !reflect.DeepEqual(results, MockUsers3) {
+		t.Errorf("Expected %v but found %v", MockUsers3, results)
+	}
+}
@@ -0,0 +1,211 @@
+package dorm
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// typeInfo is what dorm needs to know about a struct type used as a model,
+// independent of how its tables and columns are named. It is computed once
+// per type and kept in the type registry.
+type typeInfo struct {
+	fields      []int        // exported fields not tagged `dorm:"-"`, in declaration order
+	pk          int          // field tagged `dorm:"primary_key"`, or -1
+	softDelete  int          // field tagged `dorm:"soft_delete"`, or -1
+	readonly    map[int]bool // fields tagged `dorm:"readonly"`
+	unsupported int          // first field of a type the driver cannot store, or -1
+}
+
+// modelInfo is typeInfo together with the names a naming strategy gives
+// the type's table and columns, and the scan plans computed for it so far.
+type modelInfo struct {
+	*typeInfo
+	table   string
+	columns map[int]string // field -> column name
+	byName  map[string]int // column name, in lower case -> field
+	plans   sync.Map       // column list -> []int, see scanPlan
+}
+
+// modelKey identifies a modelInfo in the model registry.
+type modelKey struct {
+	t      reflect.Type
+	naming NamingStrategy
+}
+
+// The type and model registries are shared by every DB, since neither
+// depends on the database.
+var (
+	types  sync.Map // reflect.Type -> *typeInfo
+	models sync.Map // modelKey -> *modelInfo
+)
+
+// typeOf returns the registered typeInfo for the struct type t, parsing t
+// the first time it is seen.
+func typeOf(t reflect.Type) *typeInfo {
+	if info, ok := types.Load(t); ok {
+		return info.(*typeInfo)
+	}
+	info := &typeInfo{pk: -1, softDelete: -1, readonly: map[int]bool{}, unsupported: -1}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		opts := tagOptions(f)
+		if _, skip := opts["-"]; skip || !f.IsExported() {
+			continue
+		}
+		info.fields = append(info.fields, i)
+		if _, ok := opts["primary_key"]; ok && info.pk < 0 {
+			info.pk = i
+		}
+		if _, ok := opts["soft_delete"]; ok && info.softDelete < 0 {
+			info.softDelete = i
+		}
+		if _, ok := opts["readonly"]; ok {
+			info.readonly[i] = true
+		}
+		if !supportedType(f.Type) && info.unsupported < 0 {
+			info.unsupported = i
+		}
+	}
+	actual, _ := types.LoadOrStore(t, info)
+	return actual.(*typeInfo)
+}
+
+// modelOf returns the registered modelInfo for the struct type t under
+// naming strategy n. Strategies that cannot be compared, and so cannot key
+// the registry, get a new modelInfo on every call.
+func modelOf(n NamingStrategy, t reflect.Type) *modelInfo {
+	cacheable := reflect.TypeOf(n).Comparable()
+	key := modelKey{t: t, naming: n}
+	if cacheable {
+		if info, ok := models.Load(key); ok {
+			return info.(*modelInfo)
+		}
+	}
+
+	info := &modelInfo{
+		typeInfo: typeOf(t),
+		table:    tableNameWith(n, reflect.New(t).Interface()),
+		columns:  map[int]string{},
+		byName:   map[string]int{},
+	}
+	for _, i := range info.fields {
+		col := columnNameWith(n, t.Field(i))
+		info.columns[i] = col
+		if _, ok := info.byName[strings.ToLower(col)]; !ok {
+			info.byName[strings.ToLower(col)] = i
+		}
+	}
+	if !cacheable {
+		return info
+	}
+	actual, _ := models.LoadOrStore(key, info)
+	return actual.(*modelInfo)
+}
+
+// modelOf returns the registered modelInfo for the struct type t under
+// db's naming strategy.
+func (db *DB) modelOf(t reflect.Type) *modelInfo {
+	return modelOf(db.NamingStrategy(), t)
+}
+
+// columnNames returns the names of the columns for fields, in order.
+func (m *modelInfo) columnNames() []string {
+	cols := make([]string, len(m.fields))
+	for i, f := range m.fields {
+		cols[i] = m.columns[f]
+	}
+	return cols
+}
+
+// scanPlan returns, for each of cols, the field its values are stored in,
+// or -1 if there is none. A column that repeats an earlier one's name gets
+// no field. Plans are cached by column list, since a model is usually read
+// by the same few queries.
+func (m *modelInfo) scanPlan(cols []string) []int {
+	key := strings.Join(cols, "\x00")
+	if plan, ok := m.plans.Load(key); ok {
+		return plan.([]int)
+	}
+	plan := make([]int, len(cols))
+	seen := map[int]bool{}
+	for c, col := range cols {
+		// sqlite column names are case-insensitive
+		f, ok := m.byName[strings.ToLower(col)]
+		if !ok || seen[f] {
+			plan[c] = -1
+			continue
+		}
+		seen[f] = true
+		plan[c] = f
+	}
+	m.plans.Store(key, plan)
+	return plan
+}
+
+// schemaCache holds the columns of each table in the database, as read
+// from sqlite_master, so that dorm need not query a table's columns before
+// every write. DDL issued through dorm clears it; it is reloaded in one
+// query the next time a table is looked up.
+type schemaCache struct {
+	tables     map[string][]string // lower case table name -> columns
+	generation int                 // incremented by each invalidation
+}
+
+// ddl matches statements that may change the schema.
+var ddl = regexp.MustCompile(`(?i)\b(create|drop|alter)\b`)
+
+// liveColumns returns the columns of table, in order. If table is not in
+// the schema cache, the cache is reloaded; if it is still missing, the
+// error says there is no such table.
+func (db *DB) liveColumns(table string) ([]string, error) {
+	db.shared.mu.RLock()
+	cols, ok := db.shared.schema.tables[strings.ToLower(table)]
+	generation := db.shared.schema.generation
+	db.shared.mu.RUnlock()
+	if ok {
+		return cols, nil
+	}
+
+	tables := map[string][]string{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var table, col string
+			if err := rows.Scan(&table, &col); err != nil {
+				return err
+			}
+			table = strings.ToLower(table)
+			tables[table] = append(tables[table], col)
+		}
+		return rows.Err()
+	}, `SELECT m.name, p.name FROM sqlite_master m JOIN pragma_table_info(m.name) p
+		WHERE m.type = 'table' ORDER BY m.name, p.cid`)
+	if err != nil {
+		return nil, err
+	}
+
+	// a load that raced with an invalidation may be out of date already
+	db.shared.mu.Lock()
+	if db.shared.schema.generation == generation {
+		db.shared.schema.tables = tables
+	}
+	db.shared.mu.Unlock()
+
+	cols, ok = tables[strings.ToLower(table)]
+	if !ok {
+		return nil, errors.New("no such table: " + table)
+	}
+	return cols, nil
+}
+
+// invalidateSchema clears the schema cache, after DDL or a rollback that
+// may have undone some.
+func (db *DB) invalidateSchema() {
+	db.shared.mu.Lock()
+	db.shared.schema.tables = nil
+	db.shared.schema.generation++
+	db.shared.mu.Unlock()
+}
@@ -0,0 +1,122 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Tagged struct {
+	ID     int64 `dorm:"primary_key"`
+	Title  string
+	Hidden string `dorm:"-"`
+	Body   string `dorm:"column:content"`
+	secret string
+}
+
+func TestModelRegistry(t *testing.T) {
+	typ := reflect.TypeOf(Tagged{})
+	m := modelOf(defaultNaming, typ)
+	if modelOf(defaultNaming, typ) != m {
+		t.Errorf("Expected the model to be parsed once")
+	}
+	if modelOf(SnakeCase{Plural: true}, typ) == m {
+		t.Errorf("Expected a model per naming strategy")
+	}
+	if m.table != "tagged" || m.pk != 0 {
+		t.Errorf("Expected table tagged keyed on field 0 but found %v, %d", m.table, m.pk)
+	}
+	expected := []string{"id", "title", "content"}
+	if !reflect.DeepEqual(m.columnNames(), expected) {
+		t.Errorf("Expected %v but found %v", expected, m.columnNames())
+	}
+
+	db := NewDB(nil)
+	if col := db.columnName(typ, 3); col != "content" {
+		t.Errorf("Expected column content but found %v", col)
+	}
+	stamped := typeOf(reflect.TypeOf(struct {
+		ID int64
+		At string `dorm:"readonly;default:'today'"`
+	}{}))
+	if !reflect.DeepEqual(stamped.readonly, map[int]bool{1: true}) {
+		t.Errorf("Expected field 1 read-only but found %v", stamped.readonly)
+	}
+
+	plan := m.scanPlan([]string{"CONTENT", "extra", "id", "id"})
+	if !reflect.DeepEqual(plan, []int{3, -1, 0, -1}) {
+		t.Errorf("Expected plan [3 -1 0 -1] but found %v", plan)
+	}
+
+	// strategies that cannot key the registry are parsed every time
+	var n NamingStrategy = &upperNaming{}
+	if modelOf(n, typ).table != "TAGGED" {
+		t.Errorf("Expected table TAGGED but found %v", modelOf(n, typ).table)
+	}
+}
+
+func TestModelRegistryConcurrent(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ColumnNames(&Tagged{})
+			db.modelOf(reflect.TypeOf(Category{})).scanPlan([]string{"id", "name"})
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSchemaCache(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.TryCreate(&Post{Author: "alice"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+
+	// tables created outside dorm are found by reloading the cache
+	createPostTable(conn)
+	if err := db.TryCreate(&Post{Author: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	cols, err := db.liveColumns("post")
+	if err != nil || !reflect.DeepEqual(cols, []string{"id", "author", "likes"}) {
+		t.Errorf("Expected the cached columns of post but found %v, %v", cols, err)
+	}
+
+	// DDL through dorm invalidates the cache
+	if _, err := db.Exec("alter table post add column body text default ''"); err != nil {
+		t.Fatal(err)
+	}
+	cols, _ = db.liveColumns("post")
+	if len(cols) != 4 {
+		t.Errorf("Expected the new column to be seen but found %v", cols)
+	}
+
+	// a rolled back table does not linger in the cache
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.TryCreateTable(&Category{}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Create(&Category{Name: "books"})
+	tx.Rollback()
+	if err := db.TryCreate(&Category{Name: "books"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+}
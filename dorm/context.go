@@ -0,0 +1,60 @@
+package dorm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WithContext returns a handle to the same database whose statements all
+// run under ctx, so they are abandoned when ctx is cancelled or its
+// deadline passes. The handle shares db's connection and transaction.
+
+// Example usage inside an HTTP handler:
+//    posts := []Post{}
+//    err := db.WithContext(r.Context()).TryQuery(&posts, userQuery)
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// SetStatementTimeout sets the longest any single statement issued through
+// db may run before it is cancelled. A zero timeout means no limit.
+// Handles later derived from db (by WithContext, Begin, ...) inherit it.
+func (db *DB) SetStatementTimeout(timeout time.Duration) {
+	db.timeout = timeout
+}
+
+// context returns the context db's statements run under, bounded by its
+// statement timeout. The returned cancel function must always be called.
+func (db *DB) context() (context.Context, context.CancelFunc) {
+	ctx := db.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if db.timeout > 0 {
+		return context.WithTimeout(ctx, db.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// exec runs a statement that returns no rows.
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := db.context()
+	defer cancel()
+	return db.conn.ExecContext(ctx, query, args...)
+}
+
+// query runs a statement that returns rows and passes them to fn, closing
+// them once fn returns.
+func (db *DB) query(fn func(rows *sql.Rows) error, query string, args ...interface{}) error {
+	ctx, cancel := db.context()
+	defer cancel()
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return fn(rows)
+}
@@ -0,0 +1,80 @@
+package dorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Counter struct {
+	N int64
+}
+
+// a query that never finishes on its own
+const endlessQuery = `WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM c)
+	SELECT count(*) FROM c`
+
+func TestWithContextCancelled(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := []User{}
+	if err := db.WithContext(ctx).TryFind(&results); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+
+	// the original handle is unaffected
+	if err := db.TryFind(&results); err != nil || len(results) != len(MockUsers) {
+		t.Errorf("Expected %d users but found %d, %v", len(MockUsers), len(results), err)
+	}
+}
+
+func TestWithContextDeadline(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	results := []Counter{}
+	start := time.Now()
+	if err := db.WithContext(ctx).TryQuery(&results, endlessQuery); err == nil {
+		t.Errorf("Expected the query to be cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the query to stop at its deadline but it ran for %v", elapsed)
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+	db.SetStatementTimeout(50 * time.Millisecond)
+
+	results := []Counter{}
+	if err := db.TryQuery(&results, endlessQuery); err == nil {
+		t.Errorf("Expected the query to time out")
+	}
+
+	// quick statements, including ones in transactions, still succeed
+	err := db.Transaction(func(tx *Tx) error {
+		return tx.TryCreate(&User{FullName: "Frelicia"})
+	})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
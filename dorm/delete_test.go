@@ -0,0 +1,129 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDeleteByPrimaryKey(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// the other fields of a model with a key are not matched
+	if n := db.Delete(&Post{ID: 2, Author: "alice"}); n != 1 {
+		t.Errorf("Expected 1 post deleted but found %d", n)
+	}
+	if n := db.Delete(&Post{ID: 2}); n != 0 {
+		t.Errorf("Expected no post deleted but found %d", n)
+	}
+	results := []Post{}
+	db.Find(&results)
+	expected := []string{"alice:5", "alice:30", "carol:0", "bob:18"}
+	if !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v", expected, postAuthors(results))
+	}
+
+	if _, err := db.TryDelete(&Post{}); err == nil {
+		t.Errorf("Expected an error deleting an empty model")
+	}
+}
+
+func TestDeleteMatchesAllFields(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, []User2{{FullName: "Alice"}, {FullName: "Bob"}, {FullName: "Bob", EMail: "b@t"}})
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// the empty e_mail of a model is not matched against other rows'
+	n, err := db.TryDelete(&User2{FullName: "Bob", EMail: "b@t"})
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 user deleted but found %d, %v", n, err)
+	}
+	results := []User2{}
+	db.Find(&results)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 users left but found %v", results)
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	n, err := db.DeleteWhere(&Post{}, "likes < ? OR author = ?", 10, "bob")
+	if err != nil || n != 4 {
+		t.Errorf("Expected 4 posts deleted but found %d, %v", n, err)
+	}
+	results := []Post{}
+	db.Find(&results)
+	if !reflect.DeepEqual(postAuthors(results), []string{"alice:30"}) {
+		t.Errorf("Expected only alice:30 but found %v", postAuthors(results))
+	}
+
+	if _, err := db.DeleteWhere(&Post{}, " "); err == nil {
+		t.Errorf("Expected an error for an empty condition")
+	}
+	if _, err := db.DeleteWhere(&User{}, "1 = 1"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+
+	// policies are ANDed with the condition
+	db.Grant("alice", "ALL ON post")
+	db.Policy(&Post{}, "author = :current_user")
+	insertPosts(conn, []Post{{Author: "bob", Likes: 1}})
+	if n, err := db.As("alice").DeleteWhere(&Post{}, "1 = 1"); err != nil || n != 1 {
+		t.Errorf("Expected only alice's post deleted but found %d, %v", n, err)
+	}
+}
+
+func TestDeleteChecksReads(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, []User2{{FullName: "Alice", EMail: "a@t"}, {FullName: "Bob", EMail: "b@t"}})
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	// which rows a condition deletes reveals what it read
+	db.Grant("bob", "SELECT(full_name), DELETE ON user2")
+	bob := db.As("bob")
+	for _, cond := range []string{
+		"e_mail = 'a@t'",
+		"exists (select 1 from post where likes > 20)",
+		"exists (select 1 from dorm_grants)",
+	} {
+		if _, err := bob.DeleteWhere(&User2{}, cond); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected ErrPermissionDenied for %q but got %v", cond, err)
+		}
+	}
+	if _, err := bob.TryDelete(&User2{EMail: "a@t"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	results := []User2{}
+	db.Find(&results)
+	if len(results) != 2 {
+		t.Errorf("Expected no user deleted but found %v", results)
+	}
+
+	if n, err := bob.DeleteWhere(&User2{}, "full_name = ?", "Alice"); err != nil || n != 1 {
+		t.Errorf("Expected 1 user deleted but found %d, %v", n, err)
+	}
+	if n, err := bob.TryDelete(&User2{FullName: "Bob"}); err != nil || n != 1 {
+		t.Errorf("Expected 1 user deleted but found %d, %v", n, err)
+	}
+}
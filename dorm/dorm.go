@@ -1,47 +1,160 @@
 package dorm
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
-	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // DB handle
 type DB struct {
-	inner *sql.DB
+	inner    *sql.DB
+	conn     executor // inner, or the transaction this handle is bound to
+	tx       *txState // nil outside a transaction
+	ctx      context.Context
+	timeout  time.Duration
+	user     string // session user set by As; "" is unrestricted
+	masker   Masker
+	strict   bool // set by SetStrictColumns
+	naming   NamingStrategy
+	unscoped bool // set by Unscoped
+	shared   *shared
+}
+
+// shared holds the state common to a DB and every handle derived from it.
+type shared struct {
+	mu       sync.RWMutex
+	policies map[string][]string // table -> row-level security predicates
+	audit    bool                // set by EnableAudit
+	schema   schemaCache
+}
+
+// executor is the subset of *sql.DB and *sql.Tx that dorm issues
+// statements through.
+type executor interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
 // NewDB returns a new DB using the provided `conn`,
 // an sql database connection.
-// This function is provided for you. You DO NOT need to modify it.
 func NewDB(conn *sql.DB) DB {
-	return DB{inner: conn}
+	return DB{inner: conn, conn: conn, shared: &shared{policies: map[string][]string{}}}
 }
 
 // Close closes db's database connection.
-// This function is provided for you. You DO NOT need to modify it.
+// It must not be called on a transaction; use Commit or Rollback instead.
 func (db *DB) Close() error {
+	if db.tx != nil {
+		return errors.New("dorm: Close called on a transaction")
+	}
 	return db.inner.Close()
 }
 
-// source: https://stackoverflow.com/questions/56616196/how-to-convert-camel-case-string-to-snake-case
-var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
-var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+// exportedFields returns the indices of the exported fields of the struct
+// type t, in declaration order, leaving out those tagged `dorm:"-"`. The
+// slice is shared and must not be modified.
+func exportedFields(t reflect.Type) []int {
+	return typeOf(t).fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
 
-func ToSnakeCase(str string) string {
-	snake := matchFirstCap.ReplaceAllString(str, "${1}_${2}")
-	snake = matchAllCap.ReplaceAllString(snake, "${1}_${2}")
-	return strings.ToLower(snake)
+// supportedType reports whether the sql driver can store values of the Go
+// type ft natively.
+func supportedType(ft reflect.Type) bool {
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	switch ft.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return ft.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		return ft == timeType
+	}
+	return false
+}
+
+// checkFields returns ErrUnsupportedField if any exported field of the
+// struct type t has a type the sql driver cannot store natively.
+func checkFields(op string, table string, t reflect.Type) error {
+	info := typeOf(t)
+	if i := info.unsupported; i >= 0 {
+		f := t.Field(i)
+		return newErr(op, table, ErrUnsupportedField,
+			"field %v has unsupported type %v", f.Name, f.Type)
+	}
+	// the primary key holds the rowid
+	if i := info.pk; i >= 0 && !isInteger(t.Field(i).Type) {
+		f := t.Field(i)
+		return newErr(op, table, ErrUnsupportedField,
+			"primary_key field %v has type %v, not an integer type", f.Name, f.Type)
+	}
+	if i := info.softDelete; i >= 0 && t.Field(i).Type != timeType && t.Field(i).Type != reflect.PtrTo(timeType) {
+		f := t.Field(i)
+		return newErr(op, table, ErrUnsupportedField,
+			"soft_delete field %v has type %v, not time.Time or *time.Time", f.Name, f.Type)
+	}
+	return nil
+}
+
+// isInteger reports whether ft is a signed or unsigned integer type.
+func isInteger(ft reflect.Type) bool {
+	switch ft.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// setRowid stores rowid in field, the primary key field of a model, which
+// checkFields has made sure is an integer.
+func setRowid(field reflect.Value, rowid int64) {
+	if field.Kind() >= reflect.Uint && field.Kind() <= reflect.Uint64 {
+		field.SetUint(uint64(rowid))
+		return
+	}
+	field.SetInt(rowid)
+}
+
+// primaryKey returns the index of the field of the struct type t tagged
+// `dorm:"primary_key"`, or -1 if there is none.
+func primaryKey(t reflect.Type) int {
+	return typeOf(t).pk
+}
+
+// fieldByName returns the index of the exported field of the struct type t
+// whose Go name or column name is name.
+func (db *DB) fieldByName(t reflect.Type, name string) (int, bool) {
+	m := db.modelOf(t)
+	for _, i := range m.fields {
+		if name == t.Field(i).Name || name == m.columns[i] {
+			return i, true
+		}
+	}
+	return -1, false
 }
 
 // ColumnNames analyzes a struct, v, and returns a list of strings,
 // one for each of the public fields of v.
 // The i'th string returned should be equal to the name of the i'th
-// public field of v, converted to underscore_case.
-// Refer to the specification of underscore_case, below.
+// public field of v, converted to underscore_case, unless the field is
+// tagged `dorm:"column:name"`. Fields tagged `dorm:"-"` are left out.
+// Refer to the specification of underscore_case, below. ColumnNames uses
+// the default naming strategy; a DB set up with SetNamingStrategy may name
+// columns differently.
 
 // Example usage:
 // type MyStruct struct {
@@ -50,42 +163,40 @@ func ToSnakeCase(str string) string {
 // }
 // ColumnNames(&MyStruct{})    ==>   []string{"id", "user_name"}
 func ColumnNames(v interface{}) []string {
-	t := reflect.TypeOf(v).Elem()
-	cols := []string{}
-	for i := 0; i < t.NumField(); i++ {
-		if t.Field(i).IsExported() {
-			cols = append(cols, ToSnakeCase(t.Field(i).Name))
-		}
-	}
-	return cols
+	return modelOf(defaultNaming, reflect.TypeOf(v).Elem()).columnNames()
+}
+
+// columnNames returns the names of the columns for the exported fields of
+// the struct type t, in field order.
+func (db *DB) columnNames(t reflect.Type) []string {
+	return db.modelOf(t).columnNames()
 }
 
 func ColumnVal(v interface{}) []interface{} {
-	t := reflect.TypeOf(v).Elem()
-	cols := []interface{}{}
-	for i := 0; i < t.NumField(); i++ {
-		if t.Field(i).IsExported() {
-			cols = append(cols, reflect.ValueOf(v).Elem().Field(i).Interface())
-		}
+	val := reflect.ValueOf(v).Elem()
+	fields := exportedFields(val.Type())
+	cols := make([]interface{}, len(fields))
+	for c, i := range fields {
+		cols[c] = val.Field(i).Interface()
 	}
 	return cols
 }
 
 func ColumnTypes(v interface{}) []string {
 	t := reflect.TypeOf(v).Elem()
-	cols := []string{}
-	for i := 0; i < t.NumField(); i++ {
-		if t.Field(i).IsExported() {
-			cols = append(cols, fmt.Sprintf("%v", t.Field(i).Type))
-		}
-
+	fields := exportedFields(t)
+	cols := make([]string, len(fields))
+	for c, i := range fields {
+		cols[c] = t.Field(i).Type.String()
 	}
 	return cols
 }
 
 // TableName analyzes a struct, v, and returns a single string, equal
 // to the name of that struct's type, converted to underscore_case.
-// Refer to the specification of underscore_case, below.
+// Refer to the specification of underscore_case, below. A struct that
+// implements Tabler names its own table. Like ColumnNames, TableName uses
+// the default naming strategy.
 
 // Example usage:
 // type MyStruct struct {
@@ -93,36 +204,79 @@ func ColumnTypes(v interface{}) []string {
 // }
 // TableName(&MyStruct{})    ==>  "my_struct"
 func TableName(result interface{}) string {
-	val := reflect.TypeOf(result).Elem().Name()
-	return ToSnakeCase(val)
+	return tableNameWith(defaultNaming, result)
 }
 
-// Write rows resulting from SQL database query to result interface, which has
-// the type that interface r has.
-func writeRows(r interface{}, rows *sql.Rows, result interface{}) {
-	cols := ColumnNames(r)
+// sliceElem returns a pointer to a new zero value of the element type of
+// result, which must be a pointer to a slice of models.
+func sliceElem(result interface{}) interface{} {
+	return reflect.New(reflect.ValueOf(result).Type().Elem().Elem()).Interface()
+}
 
-	v := reflect.Indirect(reflect.New(reflect.ValueOf(r).Type().Elem()))
-	fields := make([]interface{}, len(cols))
+// writeRows appends the rows resulting from an SQL query to result, which
+// must be a pointer to a slice of models. Each column is stored in the
+// field it is named after, whatever their order; fields without a column,
+// and non-pointer fields whose column is NULL, are left zero. A column
+// without a field is ignored, or, if db is strict,
+// makes writeRows fail with ErrUnknownColumn, reported as coming from
+// operation op.
+func (db *DB) writeRows(op string, rows *sql.Rows, result interface{}) error {
+	t := reflect.TypeOf(result).Elem().Elem()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
 
-	for i := 0; i < len(cols); i++ {
-		t := v.Field(i).Type()
-		field := reflect.New(t).Interface()
-		fields[i] = field
+	plan := db.modelOf(t).scanPlan(cols)
+	dest := make([]interface{}, len(cols))
+	for c, f := range plan {
+		if f < 0 {
+			if db.strict {
+				return newErr(op, db.tableName(reflect.New(t).Interface()), ErrUnknownColumn,
+					"column %q has no matching field in %v", cols[c], t)
+			}
+			dest[c] = new(interface{})
+			continue
+		}
+		// a non-pointer field is scanned through a pointer, which a NULL
+		// leaves nil
+		ft := t.Field(f).Type
+		if ft.Kind() != reflect.Ptr {
+			ft = reflect.PtrTo(ft)
+		}
+		dest[c] = reflect.New(ft).Interface()
 	}
 
+	res := reflect.ValueOf(result).Elem()
 	for rows.Next() {
-		rows.Scan(fields...)
-		resultRow := reflect.New(reflect.TypeOf(r).Elem())
-		val := reflect.Indirect(resultRow)
-		for i := 0; i < len(fields); i++ {
-			if val.Field(i).CanSet() {
-				val.Field(i).Set(reflect.ValueOf(fields[i]).Elem())
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		val := reflect.New(t).Elem()
+		for c, f := range plan {
+			if f < 0 {
+				continue
 			}
+			v := reflect.ValueOf(dest[c]).Elem()
+			if v.Type() != val.Field(f).Type() {
+				if v.IsNil() {
+					continue
+				}
+				v = v.Elem()
+			}
+			val.Field(f).Set(v)
 		}
-		res := reflect.ValueOf(result).Elem()
-		res.Set(reflect.Append(reflect.Indirect(reflect.ValueOf(result)), val))
+		res.Set(reflect.Append(res, val))
 	}
+	return rows.Err()
+}
+
+// SetStrictColumns sets whether a query that returns a column with no
+// matching field in the result model fails with ErrUnknownColumn, instead
+// of the column being ignored, and whether Create fails for a field with no
+// column. Handles later derived from db inherit the setting.
+func (db *DB) SetStrictColumns(strict bool) {
+	db.strict = strict
 }
 
 // Find queries a database for all rows in a given table,
@@ -138,18 +292,14 @@ func writeRows(r interface{}, rows *sql.Rows, result interface{}) {
 //    result := []UserComment{}
 //    db.Find(&result)
 func (db *DB) Find(result interface{}) {
-	r := reflect.New(reflect.ValueOf(result).Type().Elem().Elem()).Interface()
-	tableName := TableName(r)
-
-	query := "SELECT * FROM " + tableName
-	rows, err := db.inner.Query(query)
-	if err != nil {
+	if err := db.TryFind(result); err != nil {
 		log.Panic(err)
 	}
-	defer rows.Close()
-
-	writeRows(r, rows, result)
+}
 
+// TryFind is like Find, but returns an error instead of panicking.
+func (db *DB) TryFind(result interface{}) error {
+	return db.Model(sliceElem(result)).find("Find", result)
 }
 
 // First queries a database for the first row in a table,
@@ -167,31 +317,19 @@ func (db *DB) Find(result interface{}) {
 //    ok := db.First(result)
 // with the argument), otherwise return true.
 func (db *DB) First(result interface{}) bool {
-	tableName := TableName(result)
-	cols := ColumnNames(result)
-
-	query := "SELECT * FROM " + tableName + " LIMIT 1"
-	rows, err := db.inner.Query(query)
-
-	v := reflect.ValueOf(result).Elem()
-	fields := make([]interface{}, len(cols))
-	for i := 0; i < len(cols); i++ {
-		t := v.Field(i).Type()
-		field := reflect.New(t).Interface()
-		fields[i] = field
-	}
-
-	if err != nil {
-		log.Panic(err)
+	err := db.TryFirst(result)
+	if errors.Is(err, ErrNoRows) {
 		return false
-	} else if rows.Next() {
-		rows.Scan(fields...)
-		for i := 0; i < len(fields); i++ {
-			v.Field(i).Set(reflect.ValueOf(fields[i]).Elem())
-		}
-		return true
+	} else if err != nil {
+		log.Panic(err)
 	}
-	return false
+	return true
+}
+
+// TryFirst is like First, but returns an error instead of panicking.
+// If the table contains no rows, TryFirst returns ErrNoRows.
+func (db *DB) TryFirst(result interface{}) error {
+	return db.Model(result).first("First", result)
 }
 
 // Create adds the specified model to the appropriate database table.
@@ -203,394 +341,750 @@ func (db *DB) First(result interface{}) bool {
 // field exists, Create() should ignore the provided value of that
 // field, overwriting it with the auto-incrementing row ID.
 // This ID is given by the value of last_inserted_rowid(),
-// returned from the underlying sql database.
+// returned from the underlying sql database. The field may have any signed
+// or unsigned integer type; other types are rejected with
+// ErrUnsupportedField.
+// Fields tagged `dorm:"readonly"` are not written, so their columns take
+// their default values. A row that conflicts with an existing one on a
+// UNIQUE constraint is rejected with ErrConstraintViolation; use Upsert to
+// update the existing row instead.
 func (db *DB) Create(model interface{}) {
-	rows, table_check := db.inner.Query("select * from " + TableName(model) + ";")
-	/*fmt.Println("rows", rows, table_check)
-	fmt.Println("-------------------------------")
-	val := reflect.ValueOf(model).Elem().Kind()
-	fmt.Printf("%v  kind \n", val)
-
-	fmt.Printf("%v  value \n", reflect.ValueOf(model).Elem())
-	fmt.Printf("%v  type\n", reflect.TypeOf(model).Elem())
-
-	fmt.Println(val.String())
-	fmt.Println("-------------------------------")
-	// fmt.Println(db.inner)
-	fmt.Println("calling tablenane")*/
-	name := TableName(model)
-	//fmt.Println("_________________________")
-	//fmt.Println("select * from " + name + ";")
-
-	if table_check == nil {
-		skipped := false
-		//fmt.Println("table is there")
-		//fmt.Println(rows.ColumnTypes())
-		cols, _ := rows.ColumnTypes()
-		//fmt.Println("cols", cols)
-		rows.Close()
-		colNames := []string{}
-		placeholder := []string{}
-		numExportedField := 0
-		for i := 0; i < len(cols); i++ {
-
-			for !reflect.TypeOf(model).Elem().Field(numExportedField).IsExported() {
-				numExportedField++
+	if err := db.TryCreate(model); err != nil {
+		log.Panic(err)
+	}
+}
 
+// TryCreate is like Create, but returns an error instead of panicking.
+// It returns ErrTableNotFound if the model's table does not exist.
+func (db *DB) TryCreate(model interface{}) error {
+	return db.audited(func(db *DB) error {
+		return db.create(model)
+	})
+}
+
+// create inserts model, recording the new row in the audit log.
+func (db *DB) create(model interface{}) error {
+	t := reflect.TypeOf(model).Elem()
+	return db.insert("Create", db.tableName(model), t, []reflect.Value{reflect.ValueOf(model).Elem()}, 1)
+}
+
+// insertColumns returns the columns of table name that inserting a value
+// of the struct type t writes, each set from the field it is named after,
+// with the index of each field, and the index of the field tagged
+// `dorm:"primary_key"` if the table has its column, or -1.
+func (db *DB) insertColumns(op string, name string, t reflect.Type) ([]string, []int, int, error) {
+	cols, err := db.liveColumns(name)
+	if err != nil {
+		return nil, nil, -1, wrapErr(op, name, err)
+	}
+
+	info := typeOf(t)
+	plan := db.modelOf(t).scanPlan(cols)
+	colNames := []string{}
+	fields := []int{}
+	primaryKey := -1
+	stored := map[int]bool{}
+	for c, f := range plan {
+		if f < 0 {
+			continue
+		}
+		stored[f] = true
+		if f == info.pk {
+			primaryKey = f
+			continue
+		}
+		// read-only fields are read from their columns but never written
+		if info.readonly[f] {
+			continue
+		}
+		colNames = append(colNames, cols[c])
+		fields = append(fields, f)
+	}
+	if db.strict {
+		for _, f := range exportedFields(t) {
+			if !stored[f] {
+				return nil, nil, -1, newErr(op, name, ErrUnknownColumn, "field %v has no column in %v", t.Field(f).Name, name)
 			}
-			//fmt.Println("&&&&&&&&&&&&&&&&&&", reflect.TypeOf(model).Elem().Field(numExportedField))
-			if val, ok := reflect.TypeOf(model).Elem().Field(numExportedField).Tag.Lookup("dorm"); ok {
-				if val == "primary_key" {
-					continue
-				}
-			}
-			//fmt.Println("field", i, cols[i].Name())
-			colNames = append(colNames, cols[i].Name())
-			placeholder = append(placeholder, "?")
-
-			fmt.Println("*******************************")
-			numExportedField++
-			//tag := t.Tag
-			//fmt.Println("tag", tag)
-		}
-		//fmt.Println("Placeholders", placeholder)
-		//fmt.Printf("%v  value again \n", reflect.ValueOf(model).Elem().Kind())
-		colVals := []interface{}{}
-
-		var colValsStr []string
-		//fmt.Println("len of colnames", len(colNames), len(colValsStr))
-		//  colTypes,err := rows.ColumnTypes()
-		//fmt.Println("model", reflect.ValueOf(model).Elem(), reflect.TypeOf(model))
-		ele := reflect.TypeOf(model).Elem()
-		//fmt.Println("posted", ele, ele.NumField(), ele.Field(0))
-
-		numExportedField = 0
-		for i := 0; i < ele.NumField() && numExportedField < ele.NumField(); i++ {
-			//fmt.Println("population col vals", i)
-			for !reflect.TypeOf(model).Elem().Field(numExportedField).IsExported() {
-				numExportedField++
+		}
+	}
+	return colNames, fields, primaryKey, nil
+}
+
+// authorizeInsert returns ErrPermissionDenied unless grants allow rows to
+// be inserted into table name, setting each of cols from the matching
+// field. The session user may only leave columns they cannot insert zero.
+func (db *DB) authorizeInsert(op string, grants *grantSet, name string, cols []string, fields []int, rows []reflect.Value) error {
+	for _, v := range rows {
+		for c, f := range fields {
+			if !grants.hasColumn(PrivInsert, cols[c]) && !v.Field(f).IsZero() {
+				return db.authorizeColumns(op, grants, PrivInsert, name, []string{cols[c]})
 			}
-			if val, ok := ele.Field(numExportedField).Tag.Lookup("dorm"); ok {
-				if val == "primary_key" {
-					skipped = true
-					continue
+		}
+	}
+	return nil
+}
+
+// maxVariables is the number of parameters dorm binds to one statement at
+// most: the lowest limit, SQLITE_MAX_VARIABLE_NUMBER, a build of SQLite may
+// have.
+const maxVariables = 999
+
+// insert inserts rows, values of the struct type t, into table name, at
+// most batchSize rows to a statement, and back-fills their primary keys.
+// Each new row is recorded in the audit log. Errors are reported as coming
+// from operation op.
+func (db *DB) insert(op string, name string, t reflect.Type, rows []reflect.Value, batchSize int) error {
+	if err := checkFields(op, name, t); err != nil {
+		return err
+	}
+	grants, err := db.authorize(op, PrivInsert, name)
+	if err != nil {
+		return err
+	}
+
+	colNames, fields, primaryKey, err := db.insertColumns(op, name, t)
+	if err != nil {
+		return err
+	}
+	if err := db.authorizeInsert(op, grants, name, colNames, fields, rows); err != nil {
+		return err
+	}
+
+	values := "(" + strings.TrimSuffix(strings.Repeat("?,", len(colNames)), ",") + ")"
+	if len(colNames) == 0 {
+		batchSize = 1
+	} else if max := maxVariables / len(colNames); batchSize > max {
+		batchSize = max
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:]
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+
+		query := fmt.Sprintf("INSERT INTO %v DEFAULT VALUES", name)
+		args := []interface{}{}
+		if len(colNames) > 0 {
+			tuples := make([]string, len(batch))
+			for i, v := range batch {
+				tuples[i] = values
+				for _, f := range fields {
+					args = append(args, v.Field(f).Interface())
 				}
 			}
-			//fmt.Println("after checks", i)
-			colVals = append(colVals, reflect.ValueOf(model).Elem().Field(numExportedField).Interface())
-			//fmt.Println("after checks", i, fmt.Sprintf("%v", colVals[len(colVals)-1]))
-			colValsStr = append(colValsStr, fmt.Sprintf("%v", colVals[len(colVals)-1]))
-			//fmt.Println("colnams/val", colNames[i], colVals[len(colVals)-1])
-			numExportedField++
+			query = fmt.Sprintf("INSERT INTO %v(%v) VALUES%v", name, strings.Join(colNames, ","), strings.Join(tuples, ","))
+		}
+		res, err := db.exec(query, args...)
+		if err != nil {
+			return wrapErr(op, name, err)
+		}
+		lastInsert, err := res.LastInsertId()
+		if err != nil {
+			return wrapErr(op, name, err)
 		}
 
-		//fmt.Println(colVals)
-		query := fmt.Sprintf("INSERT OR REPLACE INTO %v(%v) VALUES(%v)", name, strings.Join(colNames, ","), strings.Join(placeholder, ","))
-		//fmt.Println(query)
-		rows.Close()
-		stmt, _ := db.inner.Prepare(query)
-		//fmt.Println("stmt", stmt, err)
-		//fmt.Println(colVals...)
-		res, errExec := stmt.Exec(colVals...) // also returns uniquw id
+		// the rows one statement inserts are given consecutive rowids
+		rowids := make([]int64, len(batch))
+		for i, v := range batch {
+			rowids[i] = lastInsert - int64(len(batch)-1-i)
+			if primaryKey >= 0 {
+				setRowid(v.Field(primaryKey), rowids[i])
+			}
+		}
 
-		if errExec != nil {
-			log.Panic(errExec)
+		after, err := db.snapshotRowids(name, rowids)
+		if err != nil {
+			return wrapErr(op, name, err)
 		}
-		if errExec == nil {
-			fmt.Println("somehow nil??", "should go on then")
+		if err := db.auditRows(AuditInsert, name, nil, after, ""); err != nil {
+			return wrapErr(op, name, err)
 		}
+	}
+	return nil
+}
 
-		lastinsert, _ := res.LastInsertId()
-		//rowsAffected, _ := res.RowsAffected()
-		//fmt.Println("res", lastinsert, rowsAffected)
-		if skipped {
-			//reflect.TypeOf(model).Elem()
-			reflect.ValueOf(model).Elem().Field(0).Set(reflect.ValueOf(lastinsert))
-			//fmt.Println("model", reflect.ValueOf(model).Elem(), reflect.TypeOf(model))
+// Update writes every field of model back to its row in the appropriate
+// database table, identifying the row by the field tagged
+// `dorm:"primary_key"`. Fields tagged `dorm:"readonly"` are not written,
+// nor is a soft_delete field, which only Delete and Restore change. It
+// returns the number of rows affected, which is 0 if no row has that key
+// or the row is soft-deleted, and ErrNoPrimaryKey if model has no such
+// field.
 
+// Example usage:
+//    post.Likes++
+//    n, err := db.Update(post)
+func (db *DB) Update(model interface{}) (int64, error) {
+	t := reflect.TypeOf(model).Elem()
+	info := typeOf(t)
+	cols := []string{}
+	for _, i := range info.fields {
+		if i != info.pk && !info.readonly[i] && i != info.softDelete {
+			cols = append(cols, t.Field(i).Name)
 		}
-	} else {
-		fmt.Println("table not there")
-		log.Panic("table not there", table_check)
 	}
+	return db.update("Update", model, cols)
+}
+
+// UpdateColumns is like Update, but only writes the named fields, given
+// either as Go field names or as column names. Naming a read-only or
+// soft_delete field is an error.
 
+// Example usage:
+//    n, err := db.UpdateColumns(post, "likes", "body")
+func (db *DB) UpdateColumns(model interface{}, columns ...string) (int64, error) {
+	return db.update("UpdateColumns", model, columns)
 }
 
-func (db *DB) Filter(result interface{}, filter interface{}) {
-	r := reflect.New(reflect.ValueOf(result).Type().Elem().Elem()).Interface()
-	tableName := TableName(r)
-	cols := ColumnNames(filter)
-	colTypes := ColumnTypes(filter)
-	colVals := ColumnVal(filter)
+// Save inserts model if its primary key is zero (back-filling the key, as
+// Create does) and updates its row otherwise. It returns the number of rows
+// affected.
+func (db *DB) Save(model interface{}) (int64, error) {
+	t := reflect.TypeOf(model).Elem()
+	pk := primaryKey(t)
+	if pk < 0 {
+		return 0, &Error{Op: "Save", Table: db.tableName(model), Kind: ErrNoPrimaryKey}
+	}
+	if reflect.ValueOf(model).Elem().Field(pk).IsZero() {
+		if err := db.TryCreate(model); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+	return db.Update(model)
+}
 
-	totalString := ""
+// update issues an UPDATE of the named fields of model, keyed on its
+// primary key, reporting errors as coming from operation op.
+func (db *DB) update(op string, model interface{}, fields []string) (n int64, err error) {
+	err = db.audited(func(db *DB) error {
+		n, err = db.updateRow(op, model, fields)
+		return err
+	})
+	return n, err
+}
 
-	for i := 0; i < len(cols); i++ {
-		if colTypes[i] == "string" {
-			totalString += "(" + cols[i] + "=" + fmt.Sprintf("'%v'", colVals[i]) + ")"
-		} else {
-			totalString += "(" + cols[i] + "=" + fmt.Sprintf("%v", colVals[i]) + ")"
+// updateRow does the work of update, recording the row before and after
+// the change in the audit log.
+func (db *DB) updateRow(op string, model interface{}, fields []string) (int64, error) {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	v := reflect.ValueOf(model).Elem()
+	if err := checkFields(op, name, t); err != nil {
+		return 0, err
+	}
+	pk := primaryKey(t)
+	if pk < 0 {
+		return 0, &Error{Op: op, Table: name, Kind: ErrNoPrimaryKey}
+	}
+	grants, err := db.authorize(op, PrivUpdate, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	cols := []string{}
+	sets := []string{}
+	args := []interface{}{}
+	for _, field := range fields {
+		i, ok := db.fieldByName(t, field)
+		if !ok {
+			return 0, newErr(op, name, nil, "unknown field %q", field)
+		}
+		if typeOf(t).readonly[i] {
+			return 0, newErr(op, name, nil, "field %v is read-only", t.Field(i).Name)
 		}
-		if i != len(cols)-1 {
-			totalString += "\n OR \n"
+		if i == typeOf(t).softDelete {
+			return 0, newErr(op, name, nil, "field %v is only changed by Delete and Restore", t.Field(i).Name)
 		}
+		col := db.columnName(t, i)
+		cols = append(cols, col)
+		sets = append(sets, col+" = ?")
+		args = append(args, v.Field(i).Interface())
+	}
+	if err := db.authorizeColumns(op, grants, PrivUpdate, name, cols); err != nil {
+		return 0, err
 	}
 
-	query := fmt.Sprintf("SELECT * FROM %v WHERE %v", tableName, totalString)
-	fmt.Println("filter query:", query)
-	res, _ := db.inner.Query(query)
-	for res.Next() {
-		var full_name string
-		var e_mail string
-		res.Scan(&full_name, &e_mail)
-		fmt.Println("names:    ", full_name, e_mail)
+	where := db.columnName(t, pk) + " = ?"
+	whereArgs := []interface{}{v.Field(pk).Interface()}
+	if scope, scopeArgs := db.softDeleteScope(t); scope != "" {
+		where += " AND " + scope
+		whereArgs = append(whereArgs, scopeArgs...)
+	}
+	if policy, policyArgs := db.rowPolicy(name); policy != "" {
+		where += " AND " + policy
+		whereArgs = append(whereArgs, policyArgs...)
 	}
-	res.Close()
-	rows, err := db.inner.Query(query)
+	args = append(args, whereArgs...)
+
+	before, err := db.snapshot(name, where, whereArgs...)
 	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	res, err := db.exec(fmt.Sprintf("UPDATE %v SET %v WHERE %v", name, strings.Join(sets, ", "), where), args...)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+
+	rowids := []int64{}
+	for _, row := range before {
+		rowids = append(rowids, row.rowid)
+	}
+	after, err := db.snapshotRowids(name, rowids)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	return n, wrapErr(op, name, db.auditRows(AuditUpdate, name, before, after, ""))
+}
+
+// FilterOption configures how Filter turns a filter struct into conditions.
+type FilterOption func(*filterOptions)
+
+type filterOptions struct {
+	conj   string
+	fields []string
+}
+
+// MatchAny makes Filter return rows matching any of the filter's fields.
+// This is the default.
+func MatchAny() FilterOption {
+	return func(o *filterOptions) { o.conj = "OR" }
+}
+
+// MatchAll makes Filter return only rows matching all of the filter's fields.
+func MatchAll() FilterOption {
+	return func(o *filterOptions) { o.conj = "AND" }
+}
+
+// Fields restricts Filter to the named fields, given either as Go field
+// names or as column names. Selected fields are matched even when they
+// hold their zero value.
+func Fields(names ...string) FilterOption {
+	return func(o *filterOptions) { o.fields = append(o.fields, names...) }
+}
+
+// Filter queries a database for the rows of a table that match the fields
+// of `filter`, and stores them in the slice provided as an argument.
+// By default every non-zero exported field of filter becomes a condition
+// `column = value`, and rows matching any condition are returned; use
+// MatchAll to require every condition and Fields to choose the fields
+// explicitly. Values are always passed as bound parameters.
+
+// Example usage to find every User2 named "Frelicia" with no e-mail:
+//    result := []User2{}
+//    db.Filter(&result, &User2{FullName: "Frelicia"}, MatchAll(), Fields("FullName", "EMail"))
+func (db *DB) Filter(result interface{}, filter interface{}, opts ...FilterOption) {
+	if err := db.TryFilter(result, filter, opts...); err != nil {
 		log.Panic(err)
 	}
-	defer rows.Close()
-	writeRows(r, rows, result)
+}
+
+// TryFilter is like Filter, but returns an error instead of panicking.
+func (db *DB) TryFilter(result interface{}, filter interface{}, opts ...FilterOption) error {
+	r := sliceElem(result)
+	tableName := db.tableName(r)
+
+	o := filterOptions{conj: "OR"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	t := reflect.TypeOf(filter).Elem()
+	v := reflect.ValueOf(filter).Elem()
+	grants, err := db.authorize("Filter", PrivSelect, tableName)
+	if err != nil {
+		return err
+	}
+
+	selected := map[int]bool{}
+	for _, name := range o.fields {
+		i, ok := db.fieldByName(t, name)
+		if !ok {
+			return newErr("Filter", tableName, nil, "unknown field %q", name)
+		}
+		selected[i] = true
+	}
 
+	q := db.Model(r)
+	first := true
+	for _, i := range exportedFields(t) {
+		if len(o.fields) > 0 && !selected[i] {
+			continue
+		}
+		if len(o.fields) == 0 && v.Field(i).IsZero() {
+			continue
+		}
+		col := db.columnName(t, i)
+		// matching on a column the user cannot see would reveal its values
+		if err := db.authorizeColumns("Filter", grants, PrivSelect, tableName, []string{col}); err != nil {
+			return err
+		}
+		cond := col + " = ?"
+		val := v.Field(i).Interface()
+		if first || o.conj == "AND" {
+			q = q.Where(cond, val)
+		} else {
+			q = q.Or(cond, val)
+		}
+		first = false
+	}
+
+	return q.find("Filter", result)
 }
 
 // Query the database for the first n rows in a given table
 func (db *DB) TopN(result interface{}, n int) {
-	r := reflect.New(reflect.ValueOf(result).Type().Elem().Elem()).Interface()
-	tableName := TableName(r)
-
-	query := fmt.Sprintf("SELECT * FROM %s LIMIT %d", tableName, n)
-	rows, err := db.inner.Query(query)
-	if err != nil {
+	if err := db.TryTopN(result, n); err != nil {
 		log.Panic(err)
 	}
-	defer rows.Close()
+}
 
-	writeRows(r, rows, result)
+// TryTopN is like TopN, but returns an error instead of panicking.
+func (db *DB) TryTopN(result interface{}, n int) error {
+	return db.Model(sliceElem(result)).Limit(n).find("TopN", result)
 }
 
 // Query and return database results for a user specified SQL query
 func (db *DB) Query(result interface{}, query string) {
-	r := reflect.New(reflect.ValueOf(result).Type().Elem().Elem()).Interface()
+	if err := db.TryQuery(result, query); err != nil {
+		log.Panic(err)
+	}
+}
+
+// TryQuery is like Query, but returns an error instead of panicking.
+// Through a session handle, every table and column the query reads or
+// writes is checked against the user's privileges by the sqlite
+// authorizer, and the query fails with ErrPermissionDenied naming the
+// first object the user may not touch. Tables with a row policy cannot be
+// touched at all, since dorm cannot apply a policy to arbitrary SQL, and
+// neither can dorm's own dorm_* tables. sqlite does not say which columns
+// an INSERT writes, so it needs INSERT on the whole table, and a statement
+// that replaces conflicting rows also needs DELETE on the table.
+func (db *DB) TryQuery(result interface{}, query string) error {
+	err := db.queryAuthorized("Query", func(rows *sql.Rows) error {
+		return db.writeRows("Query", rows, result)
+	}, query)
+	return wrapErr("Query", "", err)
+}
+
+// Exec runs a user specified SQL statement, or several separated by
+// semicolons, that returns no rows, and returns the number of rows the last
+// of them affected. It is vetted and audited like TryQuery.
+
+// Example usage:
+//    n, err := db.Exec("UPDATE post SET likes = 0 WHERE author = ?", "bob")
+func (db *DB) Exec(query string, args ...interface{}) (int64, error) {
+	return db.execAuthorized("Exec", query, args...)
+}
+
+// Delete removes the row of model from the database: the row with its
+// primary key, if the field tagged `dorm:"primary_key"` is set, and
+// otherwise every row that matches all of its non-zero fields. It returns
+// the number of rows deleted, and panics if the model's table does not
+// exist or model has no non-zero fields. Session users need SELECT on the
+// columns matched, as well as DELETE.
 
-	rows, err := db.inner.Query(query)
+// Example usage:
+//    db.Delete(&Post{ID: 3})                    // post 3
+//    db.Delete(&Post{Author: "bob", Likes: 0})  // every post by bob
+func (db *DB) Delete(model interface{}) int64 {
+	n, err := db.TryDelete(model)
 	if err != nil {
 		log.Panic(err)
 	}
-	defer rows.Close()
-
-	writeRows(r, rows, result)
-}
-
-// Remove row from the database
-func (db *DB) Delete(model interface{}) {
-	//fmt.Println("in delete")
-
-	rows, table_check := db.inner.Query("select * from " + TableName(model) + ";")
-	//fmt.Println("rows",rows, table_check)
-	//fmt.Println("-------------------------------")
-	//val := reflect.ValueOf(model).Elem().Kind()
-	/*fmt.Printf("%v  kind \n", val)
-
-	fmt.Printf("%v  value \n", reflect.ValueOf(model).Elem())
-	fmt.Printf("%v  type\n", reflect.TypeOf(model).Elem())
-
-	fmt.Println(val.String())
-	fmt.Println("-------------------------------")*/
-	// fmt.Println(db.inner)
-	//fmt.Println("calling tablenane")
-	name := TableName(model)
-	//fmt.Println("_________________________")
-	fmt.Println("select * from " + name + ";")
-
-	if table_check == nil {
-		for rows.Next() {
-			var full_name string
-			rows.Scan(&full_name)
-			fmt.Println("names:    ", full_name)
-		}
-
-		//fmt.Println(r.Interface())
-		//.Elem()).Interface()
-
-		cols := ColumnNames(model)
-		//fmt.Println("col names of result:", cols, name)
-		//colTypes := ColumnTypes(model)
-		colVals := []interface{}{}
-
-		//var colValsStr []string
-		totalString := ""
-		withVal := ""
-		word := ""
-		//ele := reflect.TypeOf(model).Elem()
-		numExportedField := 0
-		for i := 0; i < len(cols)-1; i++ {
-			/*fmt.Println("population col vals", i)
-			fmt.Println("after checks", i)
-
-			fmt.Println("after checks", i)*/
-			//colValsStr = append(colValsStr, fmt.Sprintf("%v", colVals[len(colVals)-1]))
-			//fmt.Println("colnams/val", colNames[i], colVals[len(colVals)-1])
-			for !reflect.TypeOf(model).Elem().Field(numExportedField).IsExported() {
-				numExportedField++
+	return n
+}
+
+// TryDelete is like Delete, but returns an error instead of panicking.
+// It returns ErrTableNotFound if the model's table does not exist.
+func (db *DB) TryDelete(model interface{}) (int64, error) {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	where, args, err := db.matchModel("Delete", name, model)
+	if err != nil {
+		return 0, err
+	}
+	// an empty model would match every row
+	if where == "" {
+		return 0, newErr("Delete", name, nil, "model has no primary key or non-zero fields to match; use DeleteWhere")
+	}
+	return db.deleteWhere("Delete", name, t, where, args)
+}
+
+// matchModel returns the condition that selects the row of model, a pointer
+// to a struct, by its primary key if it is set, and otherwise the rows that
+// match all of its non-zero fields, with its arguments. It returns "" if
+// model has no such fields. Since which rows match reveals their values,
+// session users need SELECT on each column matched, as with Filter.
+func (db *DB) matchModel(op string, table string, model interface{}) (string, []interface{}, error) {
+	t := reflect.TypeOf(model).Elem()
+	v := reflect.ValueOf(model).Elem()
+	cols := []string{}
+	conds := []string{}
+	args := []interface{}{}
+	match := func(i int) {
+		col := db.columnName(t, i)
+		cols = append(cols, col)
+		conds = append(conds, col+" = ?")
+		args = append(args, v.Field(i).Interface())
+	}
+	if pk := primaryKey(t); pk >= 0 && !v.Field(pk).IsZero() {
+		match(pk)
+	} else {
+		for _, i := range exportedFields(t) {
+			if !v.Field(i).IsZero() {
+				match(i)
 			}
-			//fmt.Println(colTypes[i])
-			totalString += cols[i] + "=?" + " OR "
-			//if colTypes[i] == "string" {
-			word = fmt.Sprintf("%v", reflect.ValueOf(model).Elem().Field(numExportedField).Interface())
-
-			/*} else {
-				word = fmt.Sprintf("%v", reflect.ValueOf(model).Elem().Field(i).Interface())
-
-			}*/
-			colVals = append(colVals, word)
-			withVal += cols[i] + "=" + word + " OR "
-			numExportedField++
-		}
-		//fmt.Println("********", cols)
-		//fmt.Println(colTypes[len(cols)-1])
-		totalString += cols[len(cols)-1] + "=?"
-		//if colTypes[len(cols)-1] == "string" {
-		//fmt.Println(len(cols), numExportedField)
-		word = fmt.Sprintf("%v", reflect.ValueOf(model).Elem().Field(numExportedField).Interface())
-		/*} else {
-			word = fmt.Sprintf("%v", reflect.ValueOf(model).Elem().Field(len(cols)-1).Interface())
-		}*/
-		colVals = append(colVals, word)
-		withVal += cols[len(cols)-1] + "=" + word
-		//build or string
-
-		query := fmt.Sprintf("DELETE FROM %v WHERE %v", name, totalString)
-		fullString := fmt.Sprintf("DELETE FROM %v WHERE %v", name, withVal)
-		fmt.Println(query)
-
-		//fmt.Println(query)
-		rows.Close()
-		stmt, err := db.inner.Prepare(query)
-		/*fmt.Println("stmt", stmt, err, colVals)
-		fmt.Println(colVals)
-		fmt.Println(colVals...)*/
-		res, errExec := stmt.Exec(colVals...) // also returns uniquw id
-		/*for res.Next() {
-			var full_name string
-			res.Scan(&full_name)
-			fmt.Println("names:    ", full_name)
-		}*/
-		num, err := res.RowsAffected()
-		if errExec != nil {
-			fmt.Println("0", err, num)
+		}
+	}
+
+	grants, err := db.grants(table)
+	if err != nil {
+		return "", nil, wrapErr(op, table, err)
+	}
+	if err := db.authorizeColumns(op, grants, PrivSelect, table, cols); err != nil {
+		return "", nil, err
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// DeleteWhere removes the rows of the table for model that satisfy cond,
+// which may contain `?` placeholders bound to args in order. It returns the
+// number of rows deleted, and ErrTableNotFound if the model's table does
+// not exist. cond may not be empty; use TruncateTable to delete every row.
+// Through a session handle, cond is checked like a raw query, so it may
+// only read tables and columns the user may select.
+
+// Example usage:
+//    n, err := db.DeleteWhere(&Post{}, "likes < ? AND author != ?", 10, "alice")
+func (db *DB) DeleteWhere(model interface{}, cond string, args ...interface{}) (int64, error) {
+	name := db.tableName(model)
+	if strings.TrimSpace(cond) == "" {
+		return 0, newErr("DeleteWhere", name, nil, "no condition; use TruncateTable to delete every row")
+	}
+	if err := db.vetCondition("DeleteWhere", name, "("+cond+")", args); err != nil {
+		return 0, err
+	}
+	// subqueries in cond see only the rows the policies allow; its columns
+	// are still those of the row being deleted
+	where := "(" + cond + ")"
+	if scope, scopeArgs := db.policyScope(); scope != "" {
+		where = "EXISTS (" + scope + "SELECT 1 WHERE " + cond + ")"
+		args = append(scopeArgs, args...)
+	}
+	return db.deleteWhere("DeleteWhere", name, reflect.TypeOf(model).Elem(), where, args)
+}
+
+// deleteWhere removes the rows of table name, for models of the struct
+// type t, matching where, on behalf of operation op, and records them in
+// the audit log. Rows of models with a soft_delete field are only marked
+// deleted, unless db is unscoped.
+func (db *DB) deleteWhere(op string, name string, t reflect.Type, where string, args []interface{}) (n int64, err error) {
+	if err := checkFields(op, name, t); err != nil {
+		return 0, err
+	}
+	err = db.audited(func(db *DB) error {
+		if sd := typeOf(t).softDelete; sd >= 0 && !db.unscoped {
+			n, err = db.softDelete(op, name, db.columnName(t, sd), where, args)
 		} else {
-			//fmt.Println(num, err)
+			n, err = db.delete(op, name, where, args)
 		}
-		//query := "SELECT * FROM " + tableName
-		//fmt.Println("placeholder string I have: ", query)
-		fmt.Println("full string it will be: ", fullString)
-		//rows, err := db.inner.Query(query)
+		return err
+	})
+	return n, err
+}
 
-	} else {
-		//fmt.Println("table not there")
-		log.Panic("table not there", table_check)
+// delete does the work of deleteWhere.
+func (db *DB) delete(op string, name string, where string, args []interface{}) (int64, error) {
+	if _, err := db.authorize(op, PrivDelete, name); err != nil {
+		return 0, err
+	}
+	if policy, policyArgs := db.rowPolicy(name); policy != "" {
+		where += " AND " + policy
+		args = append(args, policyArgs...)
 	}
 
+	before, err := db.snapshot(name, where, args...)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	res, err := db.exec("DELETE FROM "+name+" WHERE "+where, args...)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	return n, wrapErr(op, name, db.auditRows(AuditDelete, name, before, nil, ""))
 }
 
-// limit what data in the table a user has access to
-//Might be useful to look at assignment 6
-//DCL - Data Control Language
-//GRANT:Gives a privilege to user.
-func (db *DB) Grant(userid string, permission string) {
+// CreateTable creates the table for model, with a column for each of its
+// exported fields, and the indexes declared by its tags. It does not
+// insert model. It panics if the table already
+// exists.
 
+// Example usage:
+//    db.CreateTable(&Post{})
+func (db *DB) CreateTable(model interface{}) {
+	if err := db.TryCreateTable(model); err != nil {
+		log.Panic(err)
+	}
 }
 
-// REVOKE:Takes back privileges granted from user.
-func (db *DB) Revoke(userid string, permission string) {
+// TryCreateTable is like CreateTable, but returns an error instead of
+// panicking. It returns ErrTableExists if the table already exists, and
+// ErrPermissionDenied if called through a session handle.
+func (db *DB) TryCreateTable(model interface{}) error {
+	return db.createTable("CreateTable", model, false)
+}
 
+// CreateTableIfNotExists is like TryCreateTable, but does nothing if the
+// table already exists, other than creating any of its indexes that are
+// missing.
+func (db *DB) CreateTableIfNotExists(model interface{}) error {
+	return db.createTable("CreateTableIfNotExists", model, true)
 }
 
-func sqlType(t string) string {
-	if t == "string" {
-		return "text"
-	} else {
-		return "num"
+// createTable creates the table for model and the indexes declared by its
+// tags, unless they already exist if ifNotExists is true.
+func (db *DB) createTable(op string, model interface{}, ifNotExists bool) error {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	if err := checkFields(op, name, t); err != nil {
+		return err
+	}
+	if err := db.requireAdmin(op, name); err != nil {
+		return err
+	}
+	defer db.invalidateSchema()
+	query := db.createTableSQL(name, t)
+	if ifNotExists {
+		query = strings.Replace(query, "CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)
+	}
+	stmts := []string{query}
+	for _, ix := range db.tagIndexes(name, t) {
+		stmts = append(stmts, ix.createSQL(ifNotExists))
 	}
 
+	err := db.Transaction(func(tx *Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return wrapErr(op, name, err)
 }
 
-// REVOKE:Takes back privileges granted from user.
-func (db *DB) CreateTable(model interface{}) {
-	_, table_check := db.inner.Query("select * from " + TableName(model) + ";")
-	//fmt.Println("rows", rows, table_check)
-	//fmt.Println("-------------------------------")
-	//val := reflect.ValueOf(model).Elem().Kind()
-	/*fmt.Printf("%v  kind \n", val)
-
-	fmt.Printf("%v  value \n", reflect.ValueOf(model).Elem())
-	fmt.Printf("%v  type\n", reflect.TypeOf(model).Elem())
-
-	fmt.Println(val.String())
-	fmt.Println("-------------------------------")
-	// fmt.Println(db.inner)
-	fmt.Println("calling tablenane")*/
-	name := TableName(model)
-	//fmt.Println("_________________________")
-	//fmt.Println("select * from " + name + ";")
-
-	if table_check != nil {
-
-		//fmt.Println("table should be created")
-		//t := reflect.TypeOf(model).Elem()
-		//u := reflect.New(t).Elem().Interface()
-		//fmt.Printf("u is %T, %#v\n", u, u)
-
-		/*resultValuePtr := reflect.New(t)
-		resultValue := resultValuePtr.Elem()
-		fieldCount := t.NumField()
-		fields := make([]reflect.StructField, fieldCount)
-		for i := 0; i < fieldCount; i++ {
-			fields[i] = t.Field(i)
-			fmt.Println(fields[i])
-		}
-		fmt.Println(resultValue)*/
-
-		columns := ColumnNames(model) //make([]string, fieldCount)
-		fieldCount := len(columns)
-		//fieldAddrs := make([]interface{}, fieldCount)
-		types := ColumnTypes(model)
-
-		together := make([]string, fieldCount)
-		query := "create table " + name + " (\n"
-		for i := 0; i < fieldCount; i++ {
-			//columns[i] = ToSnakeCase(fields[i].Name)
-			//fieldAddrs[i] = resultValue.Field(i).Addr().Interface()
-			//types[i] = sqlType(columns[i].Type.Name())
-			if i != fieldCount-1 {
-				together[i] = fmt.Sprintf("%v %v,", columns[i], types[i])
-			} else {
-				together[i] = fmt.Sprintf("%v %v", columns[i], sqlType(types[i]))
-			}
-			query += together[i] + "\n"
+// DropTable drops the table for model, with its rows, indexes and
+// triggers, and the grants and row policies on it, so that a table later
+// created with the same name does not inherit them. It returns
+// ErrTableNotFound if there is no such table, and ErrPermissionDenied if
+// called through a session handle.
+func (db *DB) DropTable(model interface{}) error {
+	name := db.tableName(model)
+	if err := db.requireAdmin("DropTable", name); err != nil {
+		return err
+	}
+	defer db.invalidateSchema()
+	err := db.Transaction(func(tx *Tx) error {
+		if _, err := tx.exec("DROP TABLE " + name); err != nil {
+			return err
+		}
+		if err := tx.createACLTables(); err != nil {
+			return err
 		}
-		query += ")"
-		fmt.Println("new:", columns, types)
-		fmt.Println(together)
-		fmt.Println(query)
+		_, err := tx.exec("DELETE FROM "+grantsTable+" WHERE table_name = ?", name)
+		return err
+	})
+	if err != nil {
+		return wrapErr("DropTable", name, err)
+	}
 
-		_, err := db.inner.Exec(query)
+	db.shared.mu.Lock()
+	defer db.shared.mu.Unlock()
+	delete(db.shared.policies, name)
+	return nil
+}
 
-		if err != nil {
-			panic(err)
-		}
-		/*_, err := db.inner.Exec("PRAGMA table_info(table_name);")
-		if err != nil {
-			panic(err)
-		}*/
-		//fmt.Println("ans", reflect.TypeOf(ans).Elem())
+// RenameTable renames the table for model from to the table for model to,
+// for when a model type is renamed. Grants and row policies on the table
+// move with it. It returns ErrTableNotFound if there is no table for from,
+// ErrTableExists if there already is one for to, and ErrPermissionDenied if
+// called through a session handle.
 
-		db.Create(model)
+// Example usage:
+//    err := db.RenameTable(&Post{}, &Article{})
+func (db *DB) RenameTable(from interface{}, to interface{}) error {
+	oldName, newName := db.tableName(from), db.tableName(to)
+	if err := db.requireAdmin("RenameTable", oldName); err != nil {
+		return err
+	}
+	defer db.invalidateSchema()
+	err := db.Transaction(func(tx *Tx) error {
+		if _, err := tx.exec("ALTER TABLE " + oldName + " RENAME TO " + newName); err != nil {
+			return err
+		}
+		if err := tx.createACLTables(); err != nil {
+			return err
+		}
+		_, err := tx.exec("UPDATE "+grantsTable+" SET table_name = ? WHERE table_name = ?", newName, oldName)
+		return err
+	})
+	if err != nil {
+		return wrapErr("RenameTable", oldName, err)
+	}
 
-	} else {
-		log.Panic("table already there")
+	db.shared.mu.Lock()
+	defer db.shared.mu.Unlock()
+	if policies, ok := db.shared.policies[oldName]; ok {
+		db.shared.policies[newName] = append(db.shared.policies[newName], policies...)
+		delete(db.shared.policies, oldName)
 	}
+	return nil
+}
 
+// TruncateTable deletes every row of the table for model, and restarts its
+// AUTOINCREMENT primary key, if any, from 1. With auditing on, each deleted
+// row is recorded. It returns ErrTableNotFound if there is no such table,
+// and ErrPermissionDenied if called through a session handle.
+func (db *DB) TruncateTable(model interface{}) error {
+	name := db.tableName(model)
+	if err := db.requireAdmin("TruncateTable", name); err != nil {
+		return err
+	}
+	err := db.Transaction(func(tx *Tx) error {
+		before, err := tx.snapshot(name, "")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.exec("DELETE FROM " + name); err != nil {
+			return err
+		}
+		// sqlite_sequence only exists once some table uses AUTOINCREMENT
+		exists := false
+		err = tx.query(func(rows *sql.Rows) error {
+			exists = rows.Next()
+			return rows.Err()
+		}, "SELECT 1 FROM sqlite_master WHERE name = 'sqlite_sequence'")
+		if err != nil {
+			return err
+		}
+		if exists {
+			if _, err := tx.exec("DELETE FROM sqlite_sequence WHERE name = ?", name); err != nil {
+				return err
+			}
+		}
+		return tx.auditRows(AuditDelete, name, before, nil, "")
+	})
+	return wrapErr("TruncateTable", name, err)
 }
@@ -54,6 +54,91 @@ func Test_Filter_Multiple(t *testing.T) {
 	}
 }
 
+// Check that zero-valued fields are ignored unless selected with Fields()
+func Test_Filter_ZeroValues(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, MockUsers3)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	results := []User2{}
+	db.Filter(&results, &User2{FullName: "Frelicia"})
+	expectedResults := []User2{
+		User2{FullName: "Frelicia", EMail: "f@t"},
+	}
+	if !reflect.DeepEqual(results, expectedResults) {
+		t.Errorf("incorrect")
+		fmt.Println(results, expectedResults)
+	}
+
+	results = []User2{}
+	db.Filter(&results, &User2{}, Fields("EMail"))
+	expectedResults = []User2{
+		User2{FullName: "Test User1"},
+	}
+	if !reflect.DeepEqual(results, expectedResults) {
+		t.Errorf("incorrect")
+		fmt.Println(results, expectedResults)
+	}
+
+	results = []User2{}
+	if err := db.TryFilter(&results, &User2{}, Fields("Phone")); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+}
+
+// Check that MatchAll() requires every field to match
+func Test_Filter_MatchAll(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+	insertUsers2(conn, MockUsers3)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	filter := &User2{FullName: "Frelicia", EMail: "nobody@t"}
+
+	results := []User2{}
+	db.Filter(&results, filter, MatchAll())
+	if len(results) != 0 {
+		t.Errorf("Expected 0 users but found %d", len(results))
+		fmt.Println(results)
+	}
+
+	results = []User2{}
+	db.Filter(&results, filter, MatchAny())
+	if len(results) != 1 {
+		t.Errorf("Expected 1 user but found %d", len(results))
+		fmt.Println(results)
+	}
+}
+
+// Check that values are bound rather than spliced into the SQL
+func Test_Filter_Quotes(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, append(MockUsers, User{FullName: "Conan O'Brien"}))
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	results := []User{}
+	db.Filter(&results, &User{FullName: "Conan O'Brien"})
+	if len(results) != 1 || results[0].FullName != "Conan O'Brien" {
+		t.Errorf("incorrect")
+		fmt.Println(results)
+	}
+
+	results = []User{}
+	db.Filter(&results, &User{FullName: "x' OR '1'='1"})
+	if len(results) != 0 {
+		t.Errorf("Expected 0 users but found %d", len(results))
+		fmt.Println(results)
+	}
+}
+
 // Check that Filter() panics when no table exists for a query
 func Test_Filter_Panic(t *testing.T) {
 	conn := connectSQL()
@@ -265,7 +350,7 @@ func Test_Delete_Panic(t *testing.T) {
 
 }
 
-// creates table with name and quantity and addes info on 1 row into new table
+// creates table with name and quantity, without adding any rows
 func TestCreateTable(t *testing.T) {
 	conn := connectSQL()
 	db := NewDB(conn)
@@ -289,7 +374,7 @@ func TestCreateTable(t *testing.T) {
 
 }
 
-// creates table with quantity and addes info on 1 row into new table
+// creates table with quantity, without adding any rows
 func TestCreateTable2(t *testing.T) {
 	conn := connectSQL()
 	db := NewDB(conn)
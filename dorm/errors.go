@@ -0,0 +1,99 @@
+package dorm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Sentinel errors reported by the error-returning (Try*) API.
+// Every error returned by dorm is an *Error whose Kind is one of these
+// (when the failure could be classified), so callers can test for them
+// with errors.Is, and whose Err is the underlying go-sqlite3 error, so
+// callers can inspect it with errors.As.
+var (
+	ErrTableNotFound       = errors.New("dorm: table not found")
+	ErrTableExists         = errors.New("dorm: table already exists")
+	ErrNoRows              = errors.New("dorm: no rows in result set")
+	ErrConstraintViolation = errors.New("dorm: constraint violation")
+	ErrUnsupportedField    = errors.New("dorm: unsupported field type")
+	ErrNoPrimaryKey        = errors.New("dorm: model has no primary_key field")
+	ErrPermissionDenied    = errors.New("dorm: permission denied")
+	ErrUnknownColumn       = errors.New("dorm: column and field do not match")
+)
+
+// Error describes a failed dorm operation.
+type Error struct {
+	Op    string // the DB method that failed, e.g. "Find"
+	Table string // the table the operation targeted, if known
+	Kind  error  // one of the sentinel errors above, or nil
+	Err   error  // the underlying error, usually a sqlite3.Error
+}
+
+func (e *Error) Error() string {
+	msg := "dorm: " + e.Op
+	if e.Table != "" {
+		msg += " " + e.Table
+	}
+	switch {
+	case e.Err != nil:
+		return msg + ": " + e.Err.Error()
+	case e.Kind != nil:
+		return msg + ": " + strings.TrimPrefix(e.Kind.Error(), "dorm: ")
+	}
+	return msg + ": unknown error"
+}
+
+// Unwrap returns the underlying driver error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error e was classified as.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// classify maps an error returned by database/sql or go-sqlite3 onto one
+// of the sentinel errors, returning nil if it does not fit any of them.
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoRows
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		if sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrConstraintViolation
+		}
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "no such table"):
+		return ErrTableNotFound
+	case strings.Contains(msg, "already exists"), strings.Contains(msg, "already another table"):
+		return ErrTableExists
+	}
+	return nil
+}
+
+// wrapErr wraps err as an *Error for operation op on table.
+// Errors that are already an *Error are returned unchanged.
+func wrapErr(op string, table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Op: op, Table: table, Kind: classify(err), Err: err}
+}
+
+// newErr returns an *Error of the given kind for operation op on table,
+// with a formatted detail message as its underlying error.
+func newErr(op string, table string, kind error, format string, args ...interface{}) error {
+	return &Error{Op: op, Table: table, Kind: kind, Err: fmt.Errorf(format, args...)}
+}
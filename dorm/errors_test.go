@@ -0,0 +1,163 @@
+package dorm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Check that a missing table is reported as ErrTableNotFound and still
+// exposes the underlying sqlite3 error
+func TestTryFindTableNotFound(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	results := []User{}
+	err := db.TryFind(&results)
+	if !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		t.Errorf("Expected error to wrap a sqlite3.Error but got %v", err)
+	}
+	var dormErr *Error
+	if !errors.As(err, &dormErr) || dormErr.Op != "Find" || dormErr.Table != "user" {
+		t.Errorf("Expected *Error for Find on user but got %#v", err)
+	}
+}
+
+func TestTryFirstNoRows(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	result := &User{}
+	if err := db.TryFirst(result); !errors.Is(err, ErrNoRows) {
+		t.Errorf("Expected ErrNoRows but got %v", err)
+	}
+	if db.First(result) {
+		t.Errorf("Expected First to return false on an empty table")
+	}
+
+	insertUsers(conn, MockUsers)
+	if err := db.TryFirst(result); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if result.FullName != MockUsers[0].FullName {
+		t.Errorf("Expected %v but found %v", MockUsers[0].FullName, result.FullName)
+	}
+}
+
+func TestTryCreateErrors(t *testing.T) {
+	conn := connectSQL()
+	_, err := conn.Exec(`create table user (
+		full_name text check(length(full_name) > 0)
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.TryCreate(&User{FullName: "Alice Apple"}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	err = db.TryCreate(&User{})
+	if !errors.Is(err, ErrConstraintViolation) {
+		t.Errorf("Expected ErrConstraintViolation but got %v", err)
+	}
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		t.Errorf("Expected a sqlite3 constraint error but got %v", err)
+	}
+
+	type UserFake struct {
+		FullName string
+	}
+	if err := db.TryCreate(&UserFake{FullName: "Frelicia"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+}
+
+func TestTryCreateTableErrors(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.TryCreateTable(&User{FullName: "Frelicia"}); !errors.Is(err, ErrTableExists) {
+		t.Errorf("Expected ErrTableExists but got %v", err)
+	}
+
+	type Tagged struct {
+		Name string
+		Tags map[string]string
+	}
+	if err := db.TryCreateTable(&Tagged{}); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("Expected ErrUnsupportedField but got %v", err)
+	}
+
+	// a primary key is an INTEGER column, which a string cannot map to
+	type Coded struct {
+		Code string `dorm:"primary_key"`
+		Name string
+	}
+	if err := db.TryCreateTable(&Coded{}); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("Expected ErrUnsupportedField but got %v", err)
+	}
+	if _, err := db.AutoMigrate(&Coded{}); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("Expected ErrUnsupportedField but got %v", err)
+	}
+	if cols, err := db.tableColumns("coded"); err != nil || len(cols) != 0 {
+		t.Errorf("Expected no coded table but found %v, %v", cols, err)
+	}
+}
+
+func TestPrimaryKeyTypes(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	type Counter64 struct {
+		ID    uint64 `dorm:"primary_key"`
+		Count int
+	}
+	db.CreateTable(&Counter64{})
+	counters := []Counter64{{Count: 1}, {Count: 2}}
+	if err := db.CreateMany(&counters); err != nil || counters[1].ID != 2 {
+		t.Errorf("Expected the second counter to get ID 2 but found %v, %v", counters, err)
+	}
+	counter := &Counter64{Count: 3}
+	if outcome, err := db.Upsert(counter, OnConflict{Columns: []string{"id"}}); err != nil || outcome != UpsertInserted || counter.ID != 3 {
+		t.Errorf("Expected counter 3 inserted but found %v, %v, %v", counter, outcome, err)
+	}
+
+	// the key is the rowid, which nothing but an integer can hold
+	type Coded struct {
+		Code string `dorm:"primary_key"`
+	}
+	if _, err := conn.Exec("create table coded (code integer primary key autoincrement)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TryCreate(&Coded{Code: "x"}); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("Expected ErrUnsupportedField but got %v", err)
+	}
+}
+
+func TestTryDeleteTableNotFound(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	if _, err := db.TryDelete(&User{FullName: "Frelicia"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package dorm
+
+import (
+	"database/sql"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// An Index is an index on one or more columns of a table.
+type Index struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+}
+
+// SQL returns the statement that creates ix.
+func (ix Index) SQL() string {
+	return ix.createSQL(false)
+}
+
+// createSQL returns the statement that creates ix, or, if ifNotExists is
+// true, that creates it unless it already exists.
+func (ix Index) createSQL(ifNotExists bool) string {
+	create := "CREATE INDEX "
+	if ix.Unique {
+		create = "CREATE UNIQUE INDEX "
+	}
+	if ifNotExists {
+		create += "IF NOT EXISTS "
+	}
+	return create + ix.Name + " ON " + ix.Table + " (" + strings.Join(ix.Columns, ", ") + ")"
+}
+
+// indexName returns the name dorm gives an unnamed index on columns of
+// table.
+func indexName(table string, columns []string) string {
+	return "idx_" + table + "_" + strings.Join(columns, "_")
+}
+
+// tagIndexes returns the indexes declared by the tags of the fields of the
+// struct type t, sorted by name:
+//
+//    index                     an index on the field's column alone
+//    index:name                an index called name; fields that share a
+//                              name form one index, in field order
+//    unique_index[:name]       the same, for a UNIQUE index
+//
+// A field may belong to several indexes, e.g. `dorm:"index:a,b"`.
+func (db *DB) tagIndexes(table string, t reflect.Type) []Index {
+	byName := map[string]*Index{}
+	for _, i := range exportedFields(t) {
+		f := t.Field(i)
+		col := db.columnName(t, i)
+		opts := tagOptions(f)
+		for _, kind := range []string{"index", "unique_index"} {
+			names, ok := opts[kind]
+			if !ok {
+				continue
+			}
+			for _, name := range strings.Split(names, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					name = indexName(table, []string{col})
+				}
+				ix, ok := byName[name]
+				if !ok {
+					ix = &Index{Name: name, Table: table}
+					byName[name] = ix
+				}
+				ix.Columns = append(ix.Columns, col)
+				ix.Unique = ix.Unique || kind == "unique_index"
+			}
+		}
+	}
+
+	indexes := []Index{}
+	for _, ix := range byName {
+		indexes = append(indexes, *ix)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+	return indexes
+}
+
+// CreateIndex creates an index on the table for model. The columns of
+// index may be given as Go field names or column names; if it has no name,
+// one is made up from the table and columns. Its Table is ignored. It
+// returns ErrPermissionDenied if called through a session handle.
+
+// Example usage:
+//    err := db.CreateIndex(&User2{}, dorm.Index{Columns: []string{"EMail"}, Unique: true})
+func (db *DB) CreateIndex(model interface{}, index Index) error {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	if err := db.requireAdmin("CreateIndex", name); err != nil {
+		return err
+	}
+	if len(index.Columns) == 0 {
+		return newErr("CreateIndex", name, nil, "index has no columns")
+	}
+	index.Table = name
+	columns := index.Columns
+	index.Columns = []string{}
+	for _, col := range columns {
+		i, ok := db.fieldByName(t, col)
+		if !ok {
+			return newErr("CreateIndex", name, nil, "unknown field %q", col)
+		}
+		index.Columns = append(index.Columns, db.columnName(t, i))
+	}
+	if index.Name == "" {
+		index.Name = indexName(name, index.Columns)
+	}
+	_, err := db.exec(index.SQL())
+	return wrapErr("CreateIndex", name, err)
+}
+
+// DropIndex drops the index called name from the table for model. It
+// returns ErrPermissionDenied if called through a session handle.
+func (db *DB) DropIndex(model interface{}, name string) error {
+	table := db.tableName(model)
+	if err := db.requireAdmin("DropIndex", table); err != nil {
+		return err
+	}
+	indexes, err := db.indexes(table)
+	if err != nil {
+		return wrapErr("DropIndex", table, err)
+	}
+	for _, ix := range indexes {
+		if ix.Name == name {
+			_, err := db.exec("DROP INDEX " + name)
+			return wrapErr("DropIndex", table, err)
+		}
+	}
+	return newErr("DropIndex", table, nil, "no index %q", name)
+}
+
+// Indexes returns the indexes on the table for model, sorted by name,
+// including those sqlite creates for UNIQUE constraints. Session users need
+// SELECT on the table.
+func (db *DB) Indexes(model interface{}) ([]Index, error) {
+	table := db.tableName(model)
+	if _, err := db.authorize("Indexes", PrivSelect, table); err != nil {
+		return nil, err
+	}
+	indexes, err := db.indexes(table)
+	return indexes, wrapErr("Indexes", table, err)
+}
+
+// indexes returns the indexes on table, sorted by name.
+func (db *DB) indexes(table string) ([]Index, error) {
+	indexes := []Index{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			ix := Index{Table: table}
+			if err := rows.Scan(&ix.Name, &ix.Unique); err != nil {
+				return err
+			}
+			indexes = append(indexes, ix)
+		}
+		return rows.Err()
+	}, `SELECT m.name, l."unique" FROM sqlite_master m JOIN pragma_index_list(m.tbl_name) l ON l.name = m.name
+		WHERE m.type = 'index' AND m.tbl_name = ? ORDER BY m.name`, table)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range indexes {
+		err := db.query(func(rows *sql.Rows) error {
+			for rows.Next() {
+				var col sql.NullString
+				if err := rows.Scan(&col); err != nil {
+					return err
+				}
+				// an expression has no column name
+				if col.Valid {
+					indexes[i].Columns = append(indexes[i].Columns, col.String)
+				}
+			}
+			return rows.Err()
+		}, "SELECT name FROM pragma_index_info(?) ORDER BY seqno", indexes[i].Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
+// migrateIndexes creates the indexes declared by the tags of the struct
+// type t that table does not have yet.
+func (db *DB) migrateIndexes(table string, t reflect.Type) ([]SchemaChange, error) {
+	live, err := db.indexes(table)
+	if err != nil {
+		return nil, wrapErr("AutoMigrate", table, err)
+	}
+	exists := map[string]bool{}
+	for _, ix := range live {
+		exists[ix.Name] = true
+	}
+
+	changes := []SchemaChange{}
+	for _, ix := range db.tagIndexes(table, t) {
+		if exists[ix.Name] {
+			continue
+		}
+		if _, err := db.exec(ix.SQL()); err != nil {
+			return nil, wrapErr("AutoMigrate", table, err)
+		}
+		changes = append(changes, SchemaChange{Table: table, Action: MigrateCreateIndex, Column: ix.Name, Detail: ix.SQL()})
+	}
+	return changes, nil
+}
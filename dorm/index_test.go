@@ -0,0 +1,133 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Member struct {
+	ID    int64  `dorm:"primary_key"`
+	EMail string `dorm:"unique_index"`
+	First string `dorm:"index:idx_member_name"`
+	Last  string `dorm:"index:idx_member_name"`
+	Team  string `dorm:"index"`
+}
+
+type QueryPlan struct {
+	ID      int
+	Parent  int
+	NotUsed int
+	Detail  string
+}
+
+func TestCreateTableIndexes(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Member{})
+	indexes, err := db.Indexes(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Index{
+		{Name: "idx_member_e_mail", Table: "member", Columns: []string{"e_mail"}, Unique: true},
+		{Name: "idx_member_name", Table: "member", Columns: []string{"first", "last"}},
+		{Name: "idx_member_team", Table: "member", Columns: []string{"team"}},
+	}
+	if !reflect.DeepEqual(indexes, expected) {
+		t.Errorf("Expected %v but found %v", expected, indexes)
+	}
+
+	db.Create(&Member{EMail: "a@example.com"})
+	if _, err := db.Exec("insert into member (e_mail) values ('a@example.com')"); !errors.Is(err, ErrConstraintViolation) {
+		t.Errorf("Expected ErrConstraintViolation but got %v", err)
+	}
+
+	plan := []QueryPlan{}
+	db.Query(&plan, "explain query plan select * from member where e_mail = 'a@example.com'")
+	if len(plan) == 0 || !strings.Contains(plan[0].Detail, "idx_member_e_mail") {
+		t.Errorf("Expected the query to use idx_member_e_mail but found %v", plan)
+	}
+
+	// the indexes are already there
+	if err := db.CreateTableIfNotExists(&Member{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestCreateAndDropIndex(t *testing.T) {
+	conn := connectSQL()
+	createUser2Table(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if err := db.CreateIndex(&User2{}, Index{Columns: []string{"EMail", "full_name"}}); err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := db.Indexes(&User2{})
+	expected := []Index{{Name: "idx_user2_e_mail_full_name", Table: "user2", Columns: []string{"e_mail", "full_name"}}}
+	if err != nil || !reflect.DeepEqual(indexes, expected) {
+		t.Errorf("Expected %v but found %v, %v", expected, indexes, err)
+	}
+	if err := db.CreateIndex(&User2{}, Index{Columns: []string{"Phone"}}); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+
+	db.Grant("alice", "SELECT ON user2")
+	alice := db.As("alice")
+	if _, err := alice.Indexes(&User2{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := alice.DropIndex(&User2{}, "idx_user2_e_mail_full_name"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	if err := db.DropIndex(&User2{}, "idx_user2_e_mail_full_name"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropIndex(&User2{}, "idx_user2_e_mail_full_name"); err == nil {
+		t.Errorf("Expected an error for a missing index")
+	}
+	if indexes, _ := db.Indexes(&User2{}); len(indexes) != 0 {
+		t.Errorf("Expected no indexes but found %v", indexes)
+	}
+}
+
+func TestAutoMigrateIndexes(t *testing.T) {
+	conn := connectSQL()
+	_, err := conn.Exec(`create table member (
+		id integer primary key autoincrement,
+		e_mail text,
+		first text,
+		last text,
+		team text
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	changes, err := db.AutoMigrate(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"member CREATE INDEX idx_member_e_mail",
+		"member CREATE INDEX idx_member_name",
+		"member CREATE INDEX idx_member_team",
+	}
+	if !reflect.DeepEqual(schemaActions(changes), expected) {
+		t.Errorf("Expected %v but found %v", expected, changes)
+	}
+	if changes, err := db.AutoMigrate(&Member{}); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes but found %v, %v", changes, err)
+	}
+}
@@ -0,0 +1,296 @@
+// Package migrate runs versioned schema migrations against a dorm database.
+//
+// Migrations are numbered, applied in order of their version inside one
+// transaction each, and recorded in the schema_migrations table along with
+// a checksum of their SQL, so that a migration edited after it was applied
+// is caught rather than silently diverging from the databases that ran the
+// original.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cos316.princeton.edu/assignment4/dorm"
+)
+
+// Table is the table applied migrations are recorded in.
+const Table = "schema_migrations"
+
+var (
+	ErrChecksumMismatch = errors.New("migrate: applied migration has changed")
+	ErrUnknownVersion   = errors.New("migrate: applied migration is unknown")
+	ErrDuplicateVersion = errors.New("migrate: duplicate migration version")
+	ErrIrreversible     = errors.New("migrate: migration has no down step")
+)
+
+// A Migration is one versioned change to the schema. Its Up and Down steps
+// are either Go functions or SQL scripts; Down may be omitted, in which
+// case the migration cannot be rolled back.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *dorm.Tx) error
+	Down    func(tx *dorm.Tx) error
+	UpSQL   string
+	DownSQL string
+}
+
+// Checksum identifies the SQL of m's up step. Migrations written as Go
+// functions have no checksum, and are never reported as changed.
+func (m Migration) Checksum() string {
+	if m.UpSQL == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%v", m.Version, m.Name)
+}
+
+func (m Migration) up(tx *dorm.Tx) error {
+	if m.Up != nil {
+		return m.Up(tx)
+	}
+	_, err := tx.Exec(m.UpSQL)
+	return err
+}
+
+func (m Migration) down(tx *dorm.Tx) error {
+	if m.Down != nil {
+		return m.Down(tx)
+	}
+	_, err := tx.Exec(m.DownSQL)
+	return err
+}
+
+func (m Migration) reversible() bool {
+	return m.Down != nil || m.DownSQL != ""
+}
+
+// A Record is a row of the schema_migrations table.
+type Record struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back a set of migrations.
+type Migrator struct {
+	db         *dorm.DB
+	migrations map[int64]Migration
+}
+
+// New returns a Migrator for db with no migrations.
+func New(db *dorm.DB) *Migrator {
+	return &Migrator{db: db, migrations: map[int64]Migration{}}
+}
+
+// Add registers a migration. It returns ErrDuplicateVersion if another
+// migration has the same version.
+
+// Example usage:
+//    m.Add(migrate.Migration{Version: 3, Name: "backfill_likes",
+//        Up: func(tx *dorm.Tx) error { ... }})
+func (m *Migrator) Add(migration Migration) error {
+	if _, ok := m.migrations[migration.Version]; ok {
+		return fmt.Errorf("%w: %v", ErrDuplicateVersion, migration)
+	}
+	m.migrations[migration.Version] = migration
+	return nil
+}
+
+// LoadFS registers the SQL migrations in directory dir of fsys. Each is a
+// file named <version>_<name>.up.sql, optionally with a matching
+// <version>_<name>.down.sql; other files are ignored.
+
+// Example usage:
+//    //go:embed migrations/*.sql
+//    var migrations embed.FS
+//    err := m.LoadFS(migrations, "migrations")
+func (m *Migrator) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	scripts := map[string]map[string]string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(name, ".sql")
+		step := path.Ext(base)
+		if step != ".up" && step != ".down" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		base = strings.TrimSuffix(base, step)
+		if scripts[base] == nil {
+			scripts[base] = map[string]string{}
+		}
+		scripts[base][step] = string(data)
+	}
+
+	for base, steps := range scripts {
+		up, ok := steps[".up"]
+		if !ok {
+			return fmt.Errorf("migrate: %v has a down step but no up step", base)
+		}
+		i := strings.Index(base, "_")
+		if i < 0 {
+			i = len(base)
+		}
+		version, err := strconv.ParseInt(base[:i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate: %v does not start with a version number", base)
+		}
+		name := strings.TrimPrefix(base[i:], "_")
+		err = m.Add(Migration{Version: version, Name: name, UpSQL: up, DownSQL: steps[".down"]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted returns the registered migrations in order of version.
+func (m *Migrator) sorted() []Migration {
+	migrations := []Migration{}
+	for _, migration := range m.migrations {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// Applied returns the migrations recorded as applied, in order of version.
+func (m *Migrator) Applied() ([]Record, error) {
+	if _, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS ` + Table + ` (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamp NOT NULL
+	)`); err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	err := m.db.TryQuery(&records, "SELECT version, name, checksum, applied_at FROM "+Table+" ORDER BY version")
+	return records, err
+}
+
+// Version returns the version of the latest applied migration, or 0 if
+// none has been applied.
+func (m *Migrator) Version() (int64, error) {
+	records, err := m.Applied()
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	return records[len(records)-1].Version, nil
+}
+
+// verify returns the applied migrations, after checking that each is still
+// registered with the checksum it was applied with.
+func (m *Migrator) verify() ([]Record, error) {
+	records, err := m.Applied()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		migration, ok := m.migrations[r.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d_%v", ErrUnknownVersion, r.Version, r.Name)
+		}
+		if migration.Checksum() != r.Checksum {
+			return nil, fmt.Errorf("%w: %v", ErrChecksumMismatch, migration)
+		}
+	}
+	return records, nil
+}
+
+// Up applies every pending migration in order of version, each in its own
+// transaction, and returns the ones it applied. It stops at the first that
+// fails, leaving the ones before it applied. It refuses to run at all,
+// returning ErrChecksumMismatch or ErrUnknownVersion, if an applied
+// migration has since been changed or removed.
+func (m *Migrator) Up() ([]Migration, error) {
+	records, err := m.verify()
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int64]bool{}
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+
+	done := []Migration{}
+	for _, migration := range m.sorted() {
+		if applied[migration.Version] {
+			continue
+		}
+		err := m.db.Transaction(func(tx *dorm.Tx) error {
+			if err := migration.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO "+Table+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				migration.Version, migration.Name, migration.Checksum(), time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate: applying %v: %w", migration, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Rollback undoes every applied migration with a version greater than
+// target, latest first, each in its own transaction, and returns the ones
+// it undid. It returns ErrIrreversible, before undoing anything, if one of
+// them has no down step.
+func (m *Migrator) Rollback(target int64) ([]Migration, error) {
+	records, err := m.verify()
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for i := len(records) - 1; i >= 0 && records[i].Version > target; i-- {
+		migration := m.migrations[records[i].Version]
+		if !migration.reversible() {
+			return nil, fmt.Errorf("%w: %v", ErrIrreversible, migration)
+		}
+		pending = append(pending, migration)
+	}
+
+	done := []Migration{}
+	for _, migration := range pending {
+		err := m.db.Transaction(func(tx *dorm.Tx) error {
+			if err := migration.down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM "+Table+" WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate: rolling back %v: %w", migration, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
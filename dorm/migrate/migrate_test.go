@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"cos316.princeton.edu/assignment4/dorm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func connectSQL() *sql.DB {
+	conn, err := sql.Open("sqlite3", "file:test.db?mode=memory")
+	if err != nil {
+		panic(err)
+	}
+	return conn
+}
+
+var scripts = fstest.MapFS{
+	"migrations/0001_create_post.up.sql":   {Data: []byte("CREATE TABLE post (id integer PRIMARY KEY, author text);")},
+	"migrations/0001_create_post.down.sql": {Data: []byte("DROP TABLE post;")},
+	"migrations/0002_add_likes.up.sql": {Data: []byte(`
+		ALTER TABLE post ADD COLUMN likes integer NOT NULL DEFAULT 0;
+		INSERT INTO post (author, likes) VALUES ('alice', 5);`)},
+	"migrations/0002_add_likes.down.sql": {Data: []byte("ALTER TABLE post DROP COLUMN likes;")},
+	"migrations/README.md":               {Data: []byte("not a migration")},
+}
+
+type Post struct {
+	ID     int64 `dorm:"primary_key"`
+	Author string
+	Likes  int
+}
+
+type Counter struct {
+	N int64
+}
+
+func newMigrator(t *testing.T, db *dorm.DB) *Migrator {
+	m := New(db)
+	if err := m.LoadFS(scripts, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	err := m.Add(Migration{
+		Version: 3,
+		Name:    "double_likes",
+		Up: func(tx *dorm.Tx) error {
+			_, err := tx.Exec("UPDATE post SET likes = likes * 2")
+			return err
+		},
+		Down: func(tx *dorm.Tx) error {
+			_, err := tx.Exec("UPDATE post SET likes = likes / 2")
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestUpAndRollback(t *testing.T) {
+	db := dorm.NewDB(connectSQL())
+	defer db.Close()
+	m := newMigrator(t, &db)
+
+	done, err := m.Up()
+	if err != nil || len(done) != 3 {
+		t.Fatalf("Expected 3 migrations applied but found %v, %v", done, err)
+	}
+	post := &Post{}
+	if err := db.TryFirst(post); err != nil || post.Likes != 10 {
+		t.Errorf("Expected a post with 10 likes but found %v, %v", *post, err)
+	}
+	if v, err := m.Version(); err != nil || v != 3 {
+		t.Errorf("Expected version 3 but found %d, %v", v, err)
+	}
+
+	// nothing is pending on a second run
+	if done, err := m.Up(); err != nil || len(done) != 0 {
+		t.Errorf("Expected nothing applied but found %v, %v", done, err)
+	}
+
+	done, err = m.Rollback(1)
+	if err != nil || len(done) != 2 || done[0].Version != 3 || done[1].Version != 2 {
+		t.Fatalf("Expected migrations 3 and 2 rolled back but found %v, %v", done, err)
+	}
+	records, err := m.Applied()
+	if err != nil || len(records) != 1 || records[0].Name != "create_post" || records[0].AppliedAt.IsZero() {
+		t.Errorf("Expected only create_post applied but found %v, %v", records, err)
+	}
+	counts := []Counter{}
+	err = db.TryQuery(&counts, "SELECT count(*) AS n FROM pragma_table_info('post') WHERE name = 'likes'")
+	if err != nil || counts[0].N != 0 {
+		t.Errorf("Expected the likes column to be dropped but found %v, %v", counts, err)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	db := dorm.NewDB(connectSQL())
+	defer db.Close()
+	m := newMigrator(t, &db)
+	m.Add(Migration{Version: 4, Name: "broken", UpSQL: "INSERT INTO post (author) VALUES ('bob'); INSERT INTO nowhere VALUES (1);"})
+
+	done, err := m.Up()
+	if err == nil || len(done) != 3 {
+		t.Errorf("Expected migrations 1 to 3 applied and an error but found %v, %v", done, err)
+	}
+	if v, _ := m.Version(); v != 3 {
+		t.Errorf("Expected version 3 but found %d", v)
+	}
+	posts := []Post{}
+	db.Find(&posts)
+	if len(posts) != 1 {
+		t.Errorf("Expected the broken migration's insert to be rolled back but found %v", posts)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	db := dorm.NewDB(connectSQL())
+	defer db.Close()
+	if _, err := newMigrator(t, &db).Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := New(&db)
+	edited.Add(Migration{Version: 1, Name: "create_post", UpSQL: "CREATE TABLE post (id integer PRIMARY KEY);"})
+	edited.Add(Migration{Version: 2, Name: "add_likes", UpSQL: string(scripts["migrations/0002_add_likes.up.sql"].Data)})
+	edited.Add(Migration{Version: 3, Name: "double_likes", Up: func(tx *dorm.Tx) error { return nil }})
+	if _, err := edited.Up(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch but got %v", err)
+	}
+
+	if _, err := New(&db).Rollback(0); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Expected ErrUnknownVersion but got %v", err)
+	}
+}
+
+func TestIrreversible(t *testing.T) {
+	db := dorm.NewDB(connectSQL())
+	defer db.Close()
+	m := New(&db)
+	m.Add(Migration{Version: 1, Name: "create_post", UpSQL: "CREATE TABLE post (id integer PRIMARY KEY);"})
+	if err := m.Add(Migration{Version: 1, Name: "again"}); !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("Expected ErrDuplicateVersion but got %v", err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Rollback(0); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Expected ErrIrreversible but got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package dorm
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// A NamingStrategy derives the names of tables and columns from the names
+// of Go types and fields. Names set explicitly, by a `dorm:"column:name"`
+// tag or a TableName method, take precedence over the strategy.
+type NamingStrategy interface {
+	// TableName returns the name of the table for a struct type.
+	TableName(typeName string) string
+	// ColumnName returns the name of the column for a struct field.
+	ColumnName(fieldName string) string
+	// JoinTableName returns the name of the table that joins the rows of
+	// two tables, given their names.
+	JoinTableName(left string, right string) string
+}
+
+// A Tabler is a model that names its own table, whatever the naming
+// strategy.
+
+// Example usage:
+//    func (Person) TableName() string { return "people" }
+type Tabler interface {
+	TableName() string
+}
+
+// SnakeCase is the default NamingStrategy. It names tables and columns in
+// snake_case, treating runs of capitals as one word, so that UserID becomes
+// user_id and URLs becomes urls. If Plural is set, table names are
+// pluralized in English: Category becomes categories. Join tables are
+// named after both tables, e.g. post_tag.
+type SnakeCase struct {
+	Plural bool
+}
+
+func (s SnakeCase) TableName(typeName string) string {
+	if s.Plural {
+		return Pluralize(ToSnakeCase(typeName))
+	}
+	return ToSnakeCase(typeName)
+}
+
+func (s SnakeCase) ColumnName(fieldName string) string {
+	return ToSnakeCase(fieldName)
+}
+
+func (s SnakeCase) JoinTableName(left string, right string) string {
+	return left + "_" + right
+}
+
+// defaultNaming is the strategy of handles that have not been given one.
+var defaultNaming NamingStrategy = SnakeCase{}
+
+// ToSnakeCase converts a Go identifier to snake_case. A word starts at each
+// capital that follows a lower case letter or digit, and at the last
+// capital of a run of capitals followed by a lower case letter, so that
+// acronyms stay whole: HTTPServer becomes http_server. A lone "s" after a
+// run of capitals pluralizes the acronym: IDs becomes ids.
+func ToSnakeCase(str string) string {
+	runes := []rune(str)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			switch {
+			case unicode.IsLower(prev), unicode.IsDigit(prev):
+				b.WriteByte('_')
+			case unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !acronymPlural(runes, i+1):
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// acronymPlural reports whether runes[i] is an "s" that ends a word, such
+// as the one in URLs.
+func acronymPlural(runes []rune, i int) bool {
+	return runes[i] == 's' && (i+1 == len(runes) || !unicode.IsLower(runes[i+1]))
+}
+
+// Pluralize returns the English plural of the last word of a snake_case
+// name: post becomes posts, category categories and address addresses.
+func Pluralize(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "":
+		return name
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// SetNamingStrategy sets how db derives table and column names from models.
+// Handles later derived from db inherit the strategy. A nil strategy
+// restores the default, SnakeCase{}.
+
+// Example usage:
+//    db.SetNamingStrategy(dorm.SnakeCase{Plural: true})
+//    db.Find(&[]Post{})    // SELECT ... FROM posts
+func (db *DB) SetNamingStrategy(n NamingStrategy) {
+	db.naming = n
+}
+
+// NamingStrategy returns the naming strategy db uses.
+func (db *DB) NamingStrategy() NamingStrategy {
+	if db.naming == nil {
+		return defaultNaming
+	}
+	return db.naming
+}
+
+// tableName returns the name of the table for model, a pointer to a
+// struct: the name given by its TableName method, if it has one, or else
+// the name the naming strategy gives its type.
+func (db *DB) tableName(model interface{}) string {
+	if t, ok := model.(Tabler); ok {
+		return t.TableName()
+	}
+	return db.modelOf(reflect.TypeOf(model).Elem()).table
+}
+
+func tableNameWith(n NamingStrategy, model interface{}) string {
+	if t, ok := model.(Tabler); ok {
+		return t.TableName()
+	}
+	return n.TableName(reflect.TypeOf(model).Elem().Name())
+}
+
+// columnName returns the name of the column for field i of the struct type
+// t, as recorded in the model registry.
+func (db *DB) columnName(t reflect.Type, i int) string {
+	return db.modelOf(t).columns[i]
+}
+
+// columnNameWith returns the name of the column for field f under naming
+// strategy n: the name given by a `dorm:"column:name"` tag, or else the
+// name n gives f.
+func columnNameWith(n NamingStrategy, f reflect.StructField) string {
+	if name := tagOptions(f)["column"]; name != "" {
+		return name
+	}
+	return n.ColumnName(f.Name)
+}
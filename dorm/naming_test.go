@@ -0,0 +1,158 @@
+package dorm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Category struct {
+	ID       int64 `dorm:"primary_key"`
+	Name     string
+	ImageURL string
+	TagIDs   string
+}
+
+type Person struct {
+	ID   int64 `dorm:"primary_key"`
+	Name string
+}
+
+func (Person) TableName() string {
+	return "people"
+}
+
+// upperNaming names tables and columns in upper case.
+type upperNaming struct{}
+
+func (upperNaming) TableName(typeName string) string {
+	return strings.ToUpper(typeName)
+}
+
+func (upperNaming) ColumnName(fieldName string) string {
+	return strings.ToUpper(fieldName)
+}
+
+func (upperNaming) JoinTableName(left string, right string) string {
+	return left + "_TO_" + right
+}
+
+func TestToSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"ID":            "id",
+		"UserID":        "user_id",
+		"UserName":      "user_name",
+		"EMail":         "e_mail",
+		"APIKey":        "api_key",
+		"HTTPServerURL": "http_server_url",
+		"URLs":          "urls",
+		"IDs":           "ids",
+		"TagIDsCount":   "tag_ids_count",
+		"IDStatus":      "id_status",
+		"Version2":      "version2",
+		"Ipv4Addr":      "ipv4_addr",
+	}
+	for in, expected := range cases {
+		if out := ToSnakeCase(in); out != expected {
+			t.Errorf("Expected %v to become %v but found %v", in, expected, out)
+		}
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	cases := map[string]string{
+		"post":         "posts",
+		"category":     "categories",
+		"day":          "days",
+		"address":      "addresses",
+		"box":          "boxes",
+		"branch":       "branches",
+		"blog_entry":   "blog_entries",
+		"user_profile": "user_profiles",
+	}
+	for in, expected := range cases {
+		if out := Pluralize(in); out != expected {
+			t.Errorf("Expected %v to become %v but found %v", in, expected, out)
+		}
+	}
+}
+
+func TestPluralNaming(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.SetNamingStrategy(SnakeCase{Plural: true})
+	if err := db.TryCreateTable(&Category{}); err != nil {
+		t.Fatal(err)
+	}
+	cols, err := db.tableColumns("categories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, col := range cols {
+		names = append(names, col.name)
+	}
+	expected := []string{"id", "name", "image_url", "tag_ids"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected columns %v but found %v", expected, names)
+	}
+
+	// handles derived from db inherit the strategy
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Create(&Category{Name: "books"})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	results := []Category{}
+	if err := db.TryFind(&results); err != nil || len(results) != 1 || results[0].Name != "books" {
+		t.Errorf("Expected the books category but found %v, %v", results, err)
+	}
+	if join := db.NamingStrategy().JoinTableName("posts", "categories"); join != "posts_categories" {
+		t.Errorf("Expected posts_categories but found %v", join)
+	}
+}
+
+func TestCustomNaming(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.SetNamingStrategy(upperNaming{})
+	if err := db.TryCreateTable(&Category{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&Category{Name: "books"})
+	counts := []Counter{}
+	db.Query(&counts, "select count(*) as n from CATEGORY where NAME = 'books'")
+	if counts[0].N != 1 {
+		t.Errorf("Expected the category to be stored in CATEGORY.NAME")
+	}
+
+	// a TableName method overrides the strategy
+	if err := db.TryCreateTable(&Person{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&Person{Name: "alice"})
+	people := []Person{}
+	if err := db.TryFind(&people); err != nil || len(people) != 1 {
+		t.Errorf("Expected 1 person but found %v, %v", people, err)
+	}
+	if name := TableName(&Person{}); name != "people" {
+		t.Errorf("Expected people but found %v", name)
+	}
+
+	db.SetNamingStrategy(nil)
+	if _, err := db.tableColumns("category"); err != nil {
+		t.Fatal(err)
+	}
+	if name := db.tableName(&Category{}); name != "category" {
+		t.Errorf("Expected the default strategy to name category but found %v", name)
+	}
+}
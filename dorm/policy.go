@@ -0,0 +1,90 @@
+package dorm
+
+import (
+	"sort"
+	"strings"
+)
+
+// currentUser is the placeholder in a policy predicate that stands for the
+// session user.
+const currentUser = ":current_user"
+
+// Policy attaches a row-level security predicate to the table for model.
+// For session handles created with As, the predicate is ANDed into every
+// SELECT, UPDATE and DELETE that dorm generates against the table (Find,
+// First, Filter, TopN, Model, Update and Delete), so rows it rejects can be
+// neither seen nor changed. Subqueries in the conditions given to Model and
+// DeleteWhere see only the rows the policies allow as well. Within the
+// predicate, :current_user is bound to the session user. Several policies
+// on one table must all hold. Policies
+// are kept in memory and shared by every handle derived from the same
+// NewDB; they do not apply to unrestricted handles.
+
+// Example usage:
+//    db.Policy(&Post{}, "author = :current_user")
+//    posts := []Post{}
+//    db.As("alice").Find(&posts)      // only alice's posts
+func (db *DB) Policy(model interface{}, predicate string) error {
+	table := db.tableName(model)
+	if err := db.requireAdmin("Policy", table); err != nil {
+		return err
+	}
+	db.shared.mu.Lock()
+	defer db.shared.mu.Unlock()
+	db.shared.policies[table] = append(db.shared.policies[table], predicate)
+	return nil
+}
+
+// rowPolicy returns the condition that restricts db's session user to the
+// rows of table they may access, with its arguments. It returns "" if no
+// policy applies.
+func (db *DB) rowPolicy(table string) (string, []interface{}) {
+	if db.user == "" {
+		return "", nil
+	}
+	db.shared.mu.RLock()
+	defer db.shared.mu.RUnlock()
+
+	conds := []string{}
+	args := []interface{}{}
+	for _, predicate := range db.shared.policies[table] {
+		for i := 0; i < strings.Count(predicate, currentUser); i++ {
+			args = append(args, db.user)
+		}
+		conds = append(conds, "("+strings.ReplaceAll(predicate, currentUser, "?")+")")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// policyScope returns a WITH clause that shadows each table with a row
+// policy by a CTE of the same name holding only the rows the policy lets
+// db's session user access, with its arguments. Every reference a
+// statement issued after it makes to such a table, in subqueries as well,
+// is then restricted by the policy. It returns "" if no policy applies.
+func (db *DB) policyScope() (string, []interface{}) {
+	if db.user == "" {
+		return "", nil
+	}
+	db.shared.mu.RLock()
+	tables := []string{}
+	for table := range db.shared.policies {
+		tables = append(tables, table)
+	}
+	db.shared.mu.RUnlock()
+	sort.Strings(tables)
+
+	ctes := []string{}
+	args := []interface{}{}
+	for _, table := range tables {
+		policy, policyArgs := db.rowPolicy(table)
+		if policy == "" {
+			continue
+		}
+		ctes = append(ctes, table+" AS (SELECT * FROM main."+table+" WHERE "+policy+")")
+		args = append(args, policyArgs...)
+	}
+	if len(ctes) == 0 {
+		return "", nil
+	}
+	return "WITH " + strings.Join(ctes, ", ") + " ", args
+}
@@ -0,0 +1,154 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPolicyRestrictsReads(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "ALL ON post")
+	db.Grant("bob", "ALL ON post")
+	if err := db.Policy(&Post{}, "author = :current_user"); err != nil {
+		t.Fatal(err)
+	}
+	alice := db.As("alice")
+
+	results := []Post{}
+	alice.Find(&results)
+	expected := []string{"alice:5", "alice:30"}
+	if !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v", expected, postAuthors(results))
+	}
+
+	results = []Post{}
+	alice.TopN(&results, 10)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 posts but found %d", len(results))
+	}
+
+	results = []Post{}
+	alice.Filter(&results, &Post{Likes: 12})
+	if len(results) != 0 {
+		t.Errorf("Expected bob's post to be hidden but found %v", results)
+	}
+
+	// a Where ORed with another condition cannot escape the policy
+	results = []Post{}
+	alice.Model(&Post{}).Where("likes > ?", 100).Or("1 = 1").Find(&results)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 posts but found %d", len(results))
+	}
+
+	first := &Post{}
+	if err := db.As("carol").TryFirst(first); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if err := db.As("bob").TryFirst(first); err != nil || first.Author != "bob" {
+		t.Errorf("Expected bob's first post but found %v, %v", *first, err)
+	}
+
+	if err := alice.TryQuery(&results, "select * from post"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	// the unrestricted handle still sees every row
+	results = []Post{}
+	db.Find(&results)
+	if len(results) != len(MockPosts) {
+		t.Errorf("Expected %d posts but found %d", len(MockPosts), len(results))
+	}
+}
+
+func TestPolicyRestrictsSubqueries(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "ALL ON post")
+	db.Policy(&Post{}, "author = :current_user")
+	alice := db.As("alice")
+
+	// a subquery cannot probe bob's posts, which alice may not see
+	results := []Post{}
+	err := alice.Model(&Post{}).Where("likes < (SELECT max(likes) FROM post WHERE author = 'bob')").Find(&results)
+	if err != nil || len(results) != 0 {
+		t.Errorf("Expected no posts but found %v, %v", postAuthors(results), err)
+	}
+	results = []Post{}
+	err = alice.Model(&Post{}).Where("NOT EXISTS (SELECT 1 FROM post p WHERE p.author = 'bob')").Order("post.likes").Find(&results)
+	expected := []string{"alice:5", "alice:30"}
+	if err != nil || !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v, %v", expected, postAuthors(results), err)
+	}
+	if n, err := alice.DeleteWhere(&Post{}, "EXISTS (SELECT 1 FROM post WHERE author = 'bob')"); err != nil || n != 0 {
+		t.Errorf("Expected no posts deleted but found %d, %v", n, err)
+	}
+
+	// naming the table itself would bypass the policy
+	err = alice.Model(&Post{}).Where("EXISTS (SELECT 1 FROM main.post WHERE author = 'bob')").Find(&results)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if _, err := alice.DeleteWhere(&Post{}, `EXISTS (SELECT 1 FROM "main"."post")`); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	if n, err := alice.DeleteWhere(&Post{}, "likes > (SELECT min(likes) FROM post)"); err != nil || n != 1 {
+		t.Errorf("Expected 1 post deleted but found %d, %v", n, err)
+	}
+	results = []Post{}
+	db.Find(&results)
+	expected = []string{"alice:5", "bob:12", "carol:0", "bob:18"}
+	if !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v", expected, postAuthors(results))
+	}
+}
+
+func TestPolicyRestrictsWrites(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.Grant("alice", "ALL ON post")
+	db.Policy(&Post{}, "author = :current_user")
+	db.Policy(&Post{}, "likes < 100")
+	alice := db.As("alice")
+
+	// post 2 belongs to bob
+	if n, err := alice.Update(&Post{ID: 2, Author: "alice", Likes: 1}); err != nil || n != 0 {
+		t.Errorf("Expected 0 rows updated but got %d, %v", n, err)
+	}
+	if n, err := alice.UpdateColumns(&Post{ID: 1, Likes: 6}, "likes"); err != nil || n != 1 {
+		t.Errorf("Expected 1 row updated but got %d, %v", n, err)
+	}
+
+	alice.Delete(&Post{Likes: 12})
+	alice.Delete(&Post{Likes: 30})
+
+	results := []Post{}
+	db.Find(&results)
+	expected := []string{"alice:6", "bob:12", "carol:0", "bob:18"}
+	if !reflect.DeepEqual(postAuthors(results), expected) {
+		t.Errorf("Expected %v but found %v", expected, postAuthors(results))
+	}
+
+	if err := alice.Policy(&Post{}, "1 = 1"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
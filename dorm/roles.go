@@ -0,0 +1,132 @@
+package dorm
+
+import (
+	"database/sql"
+)
+
+// memberOf is a query for the grantees whose privileges a user holds: the
+// user itself and every role it belongs to, directly or through other
+// roles. Its single parameter is the user.
+const memberOf = `WITH RECURSIVE member_of(name) AS (
+		SELECT ?
+		UNION
+		SELECT role FROM ` + rolesTable + ` JOIN member_of ON member = name
+	) SELECT name FROM member_of`
+
+// A Privilege is a privilege held on a table, or on one column of it.
+type Privilege struct {
+	Privilege string // SELECT, INSERT, UPDATE or DELETE
+	Table     string // a table name, or "*" for every table
+	Column    string // "" for every column of the table
+	Via       string // the user or role the privilege was granted to
+}
+
+// GrantRole makes member, a user or a role, a member of role, so that it
+// holds every privilege granted to role and to the roles role belongs to.
+// Privileges are given to a role with Grant.
+
+// Example usage, where admins can do everything writers can, and writers
+// everything readers can:
+//    db.Grant("reader", "SELECT")
+//    db.Grant("writer", "INSERT, UPDATE ON post")
+//    db.GrantRole("writer", "reader")
+//    db.GrantRole("admin", "writer")
+//    db.GrantRole("alice", "admin")
+func (db *DB) GrantRole(member string, role string) error {
+	if err := db.requireAdmin("GrantRole", rolesTable); err != nil {
+		return err
+	}
+	if err := db.createACLTables(); err != nil {
+		return wrapErr("GrantRole", rolesTable, err)
+	}
+	if member == role {
+		return newErr("GrantRole", rolesTable, nil, "%q cannot be a member of itself", role)
+	}
+
+	// refuse to make a role a member of one of its own members
+	cycle := false
+	err := db.query(func(rows *sql.Rows) error {
+		cycle = rows.Next()
+		return rows.Err()
+	}, memberOf+" WHERE name = ?", role, member)
+	if err != nil {
+		return wrapErr("GrantRole", rolesTable, err)
+	}
+	if cycle {
+		return newErr("GrantRole", rolesTable, nil, "%q is already a member of %q", role, member)
+	}
+
+	_, err = db.exec("INSERT OR IGNORE INTO "+rolesTable+" (member, role) VALUES (?, ?)", member, role)
+	return wrapErr("GrantRole", rolesTable, err)
+}
+
+// RevokeRole removes member from role. member keeps any privilege it holds
+// directly or through another role.
+func (db *DB) RevokeRole(member string, role string) error {
+	if err := db.requireAdmin("RevokeRole", rolesTable); err != nil {
+		return err
+	}
+	if err := db.createACLTables(); err != nil {
+		return wrapErr("RevokeRole", rolesTable, err)
+	}
+	_, err := db.exec("DELETE FROM "+rolesTable+" WHERE member = ? AND role = ?", member, role)
+	return wrapErr("RevokeRole", rolesTable, err)
+}
+
+// Roles returns every role userid belongs to, directly or through other
+// roles, in alphabetical order.
+func (db *DB) Roles(userid string) ([]string, error) {
+	if err := db.requireSelf("Roles", userid); err != nil {
+		return nil, err
+	}
+	roles := []string{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			var role string
+			if err := rows.Scan(&role); err != nil {
+				return err
+			}
+			roles = append(roles, role)
+		}
+		return rows.Err()
+	}, memberOf+" WHERE name != ? ORDER BY name", userid, userid)
+	if err != nil && classify(err) != ErrTableNotFound {
+		return nil, wrapErr("Roles", rolesTable, err)
+	}
+	return roles, nil
+}
+
+// EffectivePrivileges returns every privilege userid holds, whether granted
+// to it directly or to a role it belongs to, ordered by table, column,
+// privilege and grantee. A privilege reachable through several grantees is
+// listed once for each. Session handles may only ask about their own user.
+func (db *DB) EffectivePrivileges(userid string) ([]Privilege, error) {
+	if err := db.requireSelf("EffectivePrivileges", userid); err != nil {
+		return nil, err
+	}
+	privs := []Privilege{}
+	err := db.query(func(rows *sql.Rows) error {
+		for rows.Next() {
+			p := Privilege{}
+			if err := rows.Scan(&p.Privilege, &p.Table, &p.Column, &p.Via); err != nil {
+				return err
+			}
+			privs = append(privs, p)
+		}
+		return rows.Err()
+	}, "SELECT privilege, table_name, column_name, grantee FROM "+grantsTable+
+		" WHERE grantee IN ("+memberOf+") ORDER BY table_name, column_name, privilege, grantee", userid)
+	if err != nil && classify(err) != ErrTableNotFound {
+		return nil, wrapErr("EffectivePrivileges", grantsTable, err)
+	}
+	return privs, nil
+}
+
+// requireSelf returns ErrPermissionDenied if db is a session handle for a
+// user other than userid.
+func (db *DB) requireSelf(op string, userid string) error {
+	if db.user == "" || db.user == userid {
+		return nil
+	}
+	return db.deny(op, "", "user %q may not inspect user %q", db.user, userid)
+}
@@ -0,0 +1,133 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupRoles(db *DB) {
+	db.Grant("reader", "SELECT")
+	db.Grant("writer", "INSERT, UPDATE ON post")
+	db.Grant("admin", "DELETE ON post")
+	if err := db.GrantRole("writer", "reader"); err != nil {
+		panic(err)
+	}
+	if err := db.GrantRole("admin", "writer"); err != nil {
+		panic(err)
+	}
+}
+
+func TestRoleInheritance(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+	setupRoles(&db)
+
+	db.GrantRole("alice", "admin")
+	db.GrantRole("bob", "reader")
+	alice := db.As("alice")
+	bob := db.As("bob")
+
+	if err := alice.TryCreate(&Post{Author: "alice"}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if _, err := alice.TryDelete(&Post{Author: "alice"}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := bob.TryFind(&[]Post{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := bob.TryCreate(&Post{Author: "bob"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	roles, err := db.Roles("alice")
+	if err != nil || !reflect.DeepEqual(roles, []string{"admin", "reader", "writer"}) {
+		t.Errorf("Expected alice to be admin, reader and writer but found %v, %v", roles, err)
+	}
+
+	if err := db.GrantRole("reader", "admin"); err == nil {
+		t.Errorf("Expected an error creating a role cycle")
+	}
+	if err := bob.GrantRole("bob", "admin"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+func TestRevokeRecomputesPrivileges(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+	setupRoles(&db)
+
+	db.GrantRole("alice", "admin")
+	db.GrantRole("alice", "reader")
+	alice := db.As("alice")
+
+	// alice is still a reader directly
+	db.RevokeRole("alice", "admin")
+	if err := alice.TryFind(&[]Post{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := alice.TryCreate(&Post{Author: "alice"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+
+	// revoking from a role affects every member
+	db.GrantRole("alice", "writer")
+	db.Revoke("writer", "INSERT ON post")
+	if err := alice.TryCreate(&Post{Author: "alice"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if _, err := alice.UpdateColumns(&Post{ID: 1, Likes: 3}, "likes"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	db.RevokeRole("alice", "reader")
+	db.RevokeRole("writer", "reader")
+	if err := alice.TryFind(&[]Post{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+func TestEffectivePrivileges(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	privs, err := db.EffectivePrivileges("alice")
+	if err != nil || len(privs) != 0 {
+		t.Errorf("Expected no privileges but found %v, %v", privs, err)
+	}
+
+	setupRoles(&db)
+	db.GrantRole("alice", "writer")
+	db.Grant("alice", "SELECT(author) ON post")
+
+	privs, err = db.EffectivePrivileges("alice")
+	expected := []Privilege{
+		{Privilege: "SELECT", Table: "*", Via: "reader"},
+		{Privilege: "INSERT", Table: "post", Via: "writer"},
+		{Privilege: "UPDATE", Table: "post", Via: "writer"},
+		{Privilege: "SELECT", Table: "post", Column: "author", Via: "alice"},
+	}
+	if err != nil || !reflect.DeepEqual(privs, expected) {
+		t.Errorf("Expected %v but found %v, %v", expected, privs, err)
+	}
+
+	if _, err := db.As("alice").EffectivePrivileges("alice"); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if _, err := db.As("bob").EffectivePrivileges("alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package dorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// tagOptions parses the `dorm` struct tag of f: a list of options separated
+// by semicolons, each either a flag such as primary_key or a key:value pair
+// such as default:0. Flags map to "".
+
+// Example usage:
+//    type Post struct {
+//        ID     int64  `dorm:"primary_key"`
+//        Author string `dorm:"not_null;size:64;default:'anonymous'"`
+//        Likes  int    `dorm:"check:likes >= 0"`
+//    }
+func tagOptions(f reflect.StructField) map[string]string {
+	opts := map[string]string{}
+	tag, ok := f.Tag.Lookup("dorm")
+	if !ok {
+		return opts
+	}
+	for _, opt := range strings.Split(tag, ";") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		if i := strings.Index(opt, ":"); i >= 0 {
+			opts[strings.TrimSpace(opt[:i])] = strings.TrimSpace(opt[i+1:])
+		} else {
+			opts[opt] = ""
+		}
+	}
+	return opts
+}
+
+// hasOption reports whether the `dorm` tag of f includes option.
+func hasOption(f reflect.StructField, option string) bool {
+	_, ok := tagOptions(f)[option]
+	return ok
+}
+
+// sqlType returns the SQLite column type for values of the Go type ft.
+// Pointers are stored as the type they point to.
+func sqlType(ft reflect.Type) string {
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	switch ft.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.String:
+		return "TEXT"
+	case reflect.Slice:
+		return "BLOB"
+	case reflect.Struct:
+		if ft == timeType {
+			return "DATETIME"
+		}
+	}
+	return "BLOB"
+}
+
+// createTableSQL returns the statement that creates a table with the
+// columns of the struct type t.
+func (db *DB) createTableSQL(table string, t reflect.Type) string {
+	return "CREATE TABLE " + table + " (\n\t" + strings.Join(db.columnDefinitions(t), ",\n\t") + "\n)"
+}
+
+// columnDefinitions returns the definitions of the columns of the struct
+// type t.
+func (db *DB) columnDefinitions(t reflect.Type) []string {
+	defs := []string{}
+	for _, i := range exportedFields(t) {
+		defs = append(defs, db.columnDefinition(t, i))
+	}
+	return defs
+}
+
+// columnDefinition returns the definition of the column for field i of the
+// struct type t, with the constraints set by its tag options:
+//
+//    primary_key   INTEGER PRIMARY KEY AUTOINCREMENT, so that it is the rowid;
+//                  checkFields rejects fields of other types than integers
+//    not_null      NOT NULL
+//    unique        UNIQUE
+//    default:expr  DEFAULT expr, an SQL literal or parenthesized expression
+//    check:expr    CHECK (expr)
+//    size:n        at most n characters (or bytes, for a []byte field)
+//
+// Columns without a default default to the zero value of their field, so
+// that rows that predate a column read back as zero values, not NULLs.
+func (db *DB) columnDefinition(t reflect.Type, i int) string {
+	f := t.Field(i)
+	col := db.columnName(t, i)
+	opts := tagOptions(f)
+	if i == typeOf(t).pk {
+		return col + " INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+
+	def := col + " " + sqlType(f.Type)
+	size, sized := opts["size"]
+	if sized && sqlType(f.Type) == "TEXT" {
+		def = col + " VARCHAR(" + size + ")"
+	}
+	if _, ok := opts["not_null"]; ok {
+		def += " NOT NULL"
+	}
+	if _, ok := opts["unique"]; ok {
+		def += " UNIQUE"
+	}
+	if dflt, ok := opts["default"]; ok {
+		def += " DEFAULT " + dflt
+	} else if zero := zeroDefault(f.Type); zero != "" {
+		def += " DEFAULT " + zero
+	}
+	// SQLite does not enforce the size of a VARCHAR
+	if sized {
+		def += fmt.Sprintf(" CHECK (length(%v) <= %v)", col, size)
+	}
+	if check, ok := opts["check"]; ok {
+		def += " CHECK (" + check + ")"
+	}
+	return def
+}
+
+// zeroDefault returns the SQL literal for the zero value of the Go type ft,
+// or "" if the column should default to NULL.
+func zeroDefault(ft reflect.Type) string {
+	switch ft.Kind() {
+	case reflect.String:
+		return "''"
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "0"
+	case reflect.Slice:
+		return "X''"
+	case reflect.Struct:
+		if ft == timeType {
+			return "'0001-01-01 00:00:00+00:00'"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Account struct {
+	ID      int64  `dorm:"primary_key"`
+	Handle  string `dorm:"not_null;unique;size:8"`
+	Bio     string `dorm:"default:'hello'"`
+	Balance float64
+	Karma   int `dorm:"check:karma >= 0"`
+	Admin   bool
+	Avatar  []byte
+	Joined  time.Time
+	Nick    *string
+}
+
+func TestCreateTableTypes(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Account{})
+	db.Create(&Account{Handle: "alice", Bio: "hi", Joined: time.Now()})
+
+	cols, err := db.tableColumns("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []string{}
+	for _, col := range cols {
+		types = append(types, col.typ)
+	}
+	expected := []string{"INTEGER", "VARCHAR(8)", "TEXT", "REAL", "INTEGER", "BOOLEAN", "BLOB", "DATETIME", "TEXT"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected %v but found %v", expected, types)
+	}
+	if !cols[0].primary {
+		t.Errorf("Expected id to be the primary key")
+	}
+
+	account := &Account{}
+	if err := db.TryFirst(account); err != nil || account.ID != 1 || account.Handle != "alice" {
+		t.Errorf("Expected alice's account but found %v, %v", *account, err)
+	}
+}
+
+func TestCreateTableConstraints(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Account{})
+	db.Create(&Account{Handle: "alice"})
+
+	for _, stmt := range []string{
+		"insert into account (handle) values ('alice')",
+		"insert into account (handle) values (null)",
+		"insert into account (handle) values ('much_too_long')",
+		"insert into account (handle, karma) values ('bob', -1)",
+	} {
+		if _, err := db.Exec(stmt); !errors.Is(err, ErrConstraintViolation) {
+			t.Errorf("Expected ErrConstraintViolation for %q but got %v", stmt, err)
+		}
+	}
+
+	if _, err := db.Exec("insert into account (handle) values ('bob')"); err != nil {
+		t.Fatal(err)
+	}
+	bob := &Account{}
+	if err := db.Model(&Account{}).Where("handle = ?", "bob").First(bob); err != nil {
+		t.Fatal(err)
+	}
+	if bob.Bio != "hello" || bob.Karma != 0 || bob.Nick != nil {
+		t.Errorf("Expected the column defaults but found %+v", *bob)
+	}
+}
+
+func TestTableDDL(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	// CreateTable does not insert the model
+	db.CreateTable(&Post{Author: "alice", Likes: 5})
+	results := []Post{}
+	db.Find(&results)
+	if len(results) != 0 {
+		t.Errorf("Expected no posts but found %v", results)
+	}
+
+	if err := db.CreateTableIfNotExists(&Post{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if err := db.CreateTableIfNotExists(&User{}); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	db.Create(&User{FullName: "Frelicia"})
+
+	insertPosts(conn, MockPosts)
+	if err := db.TruncateTable(&Post{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Find(&results)
+	if len(results) != 0 {
+		t.Errorf("Expected no posts but found %v", results)
+	}
+	post := &Post{Author: "dave"}
+	db.Create(post)
+	if post.ID != 1 {
+		t.Errorf("Expected ids to restart at 1 but found %d", post.ID)
+	}
+
+	type Article struct {
+		ID     int64 `dorm:"primary_key"`
+		Author string
+		Likes  int
+	}
+	db.Grant("alice", "SELECT ON post")
+	if err := db.RenameTable(&Post{}, &Article{}); err != nil {
+		t.Fatal(err)
+	}
+	articles := []Article{}
+	if err := db.As("alice").TryFind(&articles); err != nil || len(articles) != 1 {
+		t.Errorf("Expected 1 article but found %v, %v", articles, err)
+	}
+	if err := db.TryFind(&results); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+	if err := db.RenameTable(&User{}, &Article{}); !errors.Is(err, ErrTableExists) {
+		t.Errorf("Expected ErrTableExists but got %v", err)
+	}
+
+	db.Policy(&Article{}, "author = :current_user")
+	if err := db.DropTable(&Article{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropTable(&Article{}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound but got %v", err)
+	}
+	// a new table of the same name starts without grants or policies
+	db.CreateTable(&Article{})
+	if err := db.As("alice").TryFind(&articles); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+	if policy, _ := db.As("alice").rowPolicy("article"); policy != "" {
+		t.Errorf("Expected no policy on the new table but found %v", policy)
+	}
+	if err := db.As("alice").DropTable(&User{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+type Profile struct {
+	ID      int64  `dorm:"primary_key"`
+	Email   string `dorm:"column:e_mail_address;unique_index"`
+	Cache   string `dorm:"-"`
+	Created string `dorm:"readonly;default:'today'"`
+	Name    string
+}
+
+func TestColumnTags(t *testing.T) {
+	cols := ColumnNames(&Profile{})
+	if !reflect.DeepEqual(cols, []string{"id", "e_mail_address", "created", "name"}) {
+		t.Errorf("Expected the tagged column names but found %v", cols)
+	}
+	if n := len(ColumnVal(&Profile{})); n != 4 {
+		t.Errorf("Expected 4 values but found %d", n)
+	}
+	if n := len(ColumnTypes(&Profile{})); n != 4 {
+		t.Errorf("Expected 4 types but found %d", n)
+	}
+
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Profile{})
+	live, err := db.tableColumns("profile")
+	if err != nil || len(live) != 4 || live[1].name != "e_mail_address" {
+		t.Errorf("Expected the tagged columns but found %v, %v", live, err)
+	}
+	if indexes, _ := db.Indexes(&Profile{}); len(indexes) != 1 || indexes[0].Columns[0] != "e_mail_address" {
+		t.Errorf("Expected an index on e_mail_address but found %v", indexes)
+	}
+
+	alice := &Profile{Email: "a@example.com", Cache: "cached", Created: "yesterday", Name: "alice"}
+	db.Create(alice)
+	db.Create(&Profile{Email: "b@example.com", Name: "bob"})
+
+	found := &Profile{}
+	if err := db.TryFirst(found); err != nil {
+		t.Fatal(err)
+	}
+	expected := Profile{ID: alice.ID, Email: "a@example.com", Created: "today", Name: "alice"}
+	if *found != expected {
+		t.Errorf("Expected %v but found %v", expected, *found)
+	}
+
+	found.Created = "tomorrow"
+	found.Name = "alicia"
+	if _, err := db.Update(found); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateColumns(found, "Created"); err == nil {
+		t.Errorf("Expected an error updating a read-only field")
+	}
+	results := []Profile{}
+	db.Filter(&results, &Profile{Email: "a@example.com"})
+	if len(results) != 1 || results[0].Name != "alicia" || results[0].Created != "today" {
+		t.Errorf("Expected alicia's profile, created today, but found %v", results)
+	}
+
+	db.Delete(&Profile{Email: "a@example.com", Name: "alicia"})
+	results = []Profile{}
+	db.Find(&results)
+	if len(results) != 1 || results[0].Name != "bob" {
+		t.Errorf("Expected only bob's profile but found %v", results)
+	}
+}
@@ -0,0 +1,173 @@
+package dorm
+
+import (
+	"reflect"
+	"time"
+)
+
+// A model with a time.Time or *time.Time field tagged `dorm:"soft_delete"`
+// is soft-deleted: Delete and DeleteWhere set the field's column to the
+// time of deletion instead of removing the row, and Find, First, Filter,
+// TopN and Model leave out rows whose column is set. A zero time or NULL
+// marks a row that has not been deleted.
+
+// Example usage:
+//    type Note struct {
+//        ID        int64 `dorm:"primary_key"`
+//        Text      string
+//        DeletedAt *time.Time `dorm:"soft_delete"`
+//    }
+
+// Unscoped returns a handle that ignores soft deletion: its queries return
+// soft-deleted rows along with the rest, and its Delete and DeleteWhere
+// remove rows for good.
+
+// Example usage:
+//    all := []Note{}
+//    db.Unscoped().Find(&all)
+func (db *DB) Unscoped() *DB {
+	c := *db
+	c.unscoped = true
+	return &c
+}
+
+// notDeleted returns the condition that holds for the rows of a table whose
+// soft_delete column col is not set, with its arguments.
+func notDeleted(col string) (string, []interface{}) {
+	return "(" + col + " IS NULL OR " + col + " = ?)", []interface{}{time.Time{}}
+}
+
+// deleted returns the condition that holds for soft-deleted rows.
+func deleted(col string) (string, []interface{}) {
+	return "(" + col + " IS NOT NULL AND " + col + " != ?)", []interface{}{time.Time{}}
+}
+
+// softDeleteScope returns the condition that leaves soft-deleted rows out of
+// queries of the struct type t, with its arguments, or "" if t has no
+// soft_delete field or db is unscoped.
+func (db *DB) softDeleteScope(t reflect.Type) (string, []interface{}) {
+	sd := typeOf(t).softDelete
+	if sd < 0 || db.unscoped {
+		return "", nil
+	}
+	return notDeleted(db.columnName(t, sd))
+}
+
+// softDelete marks the rows of table name matching where as deleted, by
+// setting their soft_delete column col, on behalf of operation op. Rows
+// already deleted keep the time they were deleted at. The rows are recorded
+// in the audit log as deleted, with their values after the change.
+func (db *DB) softDelete(op string, name string, col string, where string, args []interface{}) (int64, error) {
+	if _, err := db.authorize(op, PrivDelete, name); err != nil {
+		return 0, err
+	}
+	live, liveArgs := notDeleted(col)
+	return db.updateWhere(op, AuditDelete, name, col+" = ?", []interface{}{time.Now().UTC()},
+		where+" AND "+live, append(args, liveArgs...))
+}
+
+// updateWhere runs UPDATE name SET set WHERE where, with the row policies
+// of name ANDed to where, and records the rows changed in the audit log as
+// operation. It returns the number of rows changed.
+func (db *DB) updateWhere(op string, operation string, name string, set string, setArgs []interface{}, where string, args []interface{}) (int64, error) {
+	if policy, policyArgs := db.rowPolicy(name); policy != "" {
+		where += " AND " + policy
+		args = append(args, policyArgs...)
+	}
+
+	before, err := db.snapshot(name, where, args...)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	res, err := db.exec("UPDATE "+name+" SET "+set+" WHERE "+where, append(setArgs, args...)...)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+
+	rowids := []int64{}
+	for _, row := range before {
+		rowids = append(rowids, row.rowid)
+	}
+	after, err := db.snapshotRowids(name, rowids)
+	if err != nil {
+		return 0, wrapErr(op, name, err)
+	}
+	return n, wrapErr(op, name, db.auditRows(operation, name, before, after, ""))
+}
+
+// Restore undeletes the soft-deleted row of model: the row with its primary
+// key, if that is set, and otherwise every soft-deleted row that matches
+// all of its non-zero fields. It returns the number of rows restored, and
+// an error if model has no soft_delete field. Session users need UPDATE on
+// the soft_delete column.
+
+// Example usage:
+//    n, err := db.Restore(&Note{ID: 7})
+func (db *DB) Restore(model interface{}) (n int64, err error) {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	if err := checkFields("Restore", name, t); err != nil {
+		return 0, err
+	}
+	sd := typeOf(t).softDelete
+	if sd < 0 {
+		return 0, newErr("Restore", name, nil, "%v has no soft_delete field", t)
+	}
+	col := db.columnName(t, sd)
+
+	// the deletion time of model itself is not matched
+	match := reflect.New(t)
+	match.Elem().Set(reflect.ValueOf(model).Elem())
+	match.Elem().Field(sd).Set(reflect.Zero(t.Field(sd).Type))
+	where, args, err := db.matchModel("Restore", name, match.Interface())
+	if err != nil {
+		return 0, err
+	}
+	if where == "" {
+		return 0, newErr("Restore", name, nil, "model has no primary key or non-zero fields to match")
+	}
+	gone, goneArgs := deleted(col)
+
+	// the column is reset to what a new row would hold
+	var zero interface{} = time.Time{}
+	if t.Field(sd).Type.Kind() == reflect.Ptr {
+		zero = nil
+	}
+
+	err = db.audited(func(db *DB) error {
+		grants, err := db.authorize("Restore", PrivUpdate, name)
+		if err != nil {
+			return err
+		}
+		if err := db.authorizeColumns("Restore", grants, PrivUpdate, name, []string{col}); err != nil {
+			return err
+		}
+		n, err = db.updateWhere("Restore", AuditUpdate, name, col+" = ?", []interface{}{zero},
+			where+" AND "+gone, append(args, goneArgs...))
+		return err
+	})
+	return n, err
+}
+
+// Purge permanently removes the rows of the table for model that were
+// soft-deleted more than olderThan ago, and returns how many there were.
+// It returns an error if model has no soft_delete field.
+
+// Example usage:
+//    n, err := db.Purge(&Note{}, 30*24*time.Hour)
+func (db *DB) Purge(model interface{}, olderThan time.Duration) (int64, error) {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	sd := typeOf(t).softDelete
+	if sd < 0 {
+		return 0, newErr("Purge", name, nil, "%v has no soft_delete field", t)
+	}
+	col := db.columnName(t, sd)
+	gone, args := deleted(col)
+	cutoff := time.Now().UTC().Add(-olderThan)
+	return db.Unscoped().deleteWhere("Purge", name, t, gone+" AND "+col+" < ?", append(args, cutoff))
+}
@@ -0,0 +1,246 @@
+package dorm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Note struct {
+	ID        int64 `dorm:"primary_key"`
+	Text      string
+	DeletedAt *time.Time `dorm:"soft_delete"`
+}
+
+type Memo struct {
+	ID        int64 `dorm:"primary_key"`
+	Text      string
+	DeletedAt time.Time `dorm:"soft_delete"`
+}
+
+type Tag struct {
+	ID        int64  `dorm:"primary_key"`
+	Key       string `dorm:"unique"`
+	Count     int
+	DeletedAt *time.Time `dorm:"soft_delete"`
+}
+
+type BadNote struct {
+	ID        int64 `dorm:"primary_key"`
+	DeletedAt bool  `dorm:"soft_delete"`
+}
+
+func noteTexts(notes []Note) []string {
+	texts := []string{}
+	for _, n := range notes {
+		texts = append(texts, n.Text)
+	}
+	return texts
+}
+
+func TestSoftDelete(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Note{})
+	notes := []Note{{Text: "a"}, {Text: "b"}, {Text: "c"}}
+	if err := db.CreateMany(&notes); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := db.Delete(&Note{ID: notes[0].ID}); n != 1 {
+		t.Errorf("Expected 1 note deleted but found %d", n)
+	}
+	if n, err := db.DeleteWhere(&Note{}, "text = ?", "b"); err != nil || n != 1 {
+		t.Errorf("Expected 1 note deleted but found %d, %v", n, err)
+	}
+	// deleting again leaves the time of deletion alone
+	if n := db.Delete(&Note{ID: notes[0].ID}); n != 0 {
+		t.Errorf("Expected no note deleted but found %d", n)
+	}
+
+	results := []Note{}
+	db.Find(&results)
+	if len(results) != 1 || results[0].Text != "c" {
+		t.Errorf("Expected only c but found %v", noteTexts(results))
+	}
+	first := Note{}
+	if err := db.Model(&Note{}).Where("id = ?", notes[0].ID).First(&first); !errors.Is(err, ErrNoRows) {
+		t.Errorf("Expected First to skip the deleted note but got %v, %v", first, err)
+	}
+	results = []Note{}
+	db.Filter(&results, &Note{Text: "a"})
+	if len(results) != 0 {
+		t.Errorf("Expected Filter to skip the deleted note but found %v", noteTexts(results))
+	}
+	results = []Note{}
+	db.TopN(&results, 5)
+	if len(results) != 1 {
+		t.Errorf("Expected TopN to skip the deleted notes but found %v", noteTexts(results))
+	}
+
+	results = []Note{}
+	db.Unscoped().Find(&results)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 notes unscoped but found %v", noteTexts(results))
+	}
+	if results[0].DeletedAt == nil || results[2].DeletedAt != nil {
+		t.Errorf("Expected only the deleted notes to have DeletedAt set")
+	}
+
+	// an unscoped handle deletes for good
+	if n := db.Unscoped().Delete(&Note{ID: notes[1].ID}); n != 1 {
+		t.Errorf("Expected 1 note removed but found %d", n)
+	}
+	results = []Note{}
+	db.Unscoped().Find(&results)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 notes left but found %v", noteTexts(results))
+	}
+
+	if _, err := db.TryDelete(&BadNote{ID: 1}); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("Expected ErrUnsupportedField but got %v", err)
+	}
+}
+
+func TestSoftDeletedNotUpdated(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Tag{})
+	tag := &Tag{Key: "a", Count: 1}
+	db.Create(tag)
+	db.Delete(&Tag{ID: tag.ID})
+
+	// a deleted row is neither changed nor brought back
+	if n, err := db.Update(&Tag{ID: tag.ID, Key: "a", Count: 2}); err != nil || n != 0 {
+		t.Errorf("Expected no tag updated but found %d, %v", n, err)
+	}
+	outcome, err := db.Upsert(&Tag{Key: "a", Count: 3}, OnConflict{Columns: []string{"key"}})
+	if err != nil || outcome != UpsertIgnored {
+		t.Errorf("Expected the conflict to be ignored but found %v, %v", outcome, err)
+	}
+	found := &Tag{}
+	if err := db.Unscoped().TryFirst(found); err != nil || found.DeletedAt == nil || found.Count != 1 {
+		t.Errorf("Expected the tag to stay deleted and unchanged but found %+v, %v", found, err)
+	}
+
+	// only Delete and Restore write the column
+	if _, err := db.UpdateColumns(&Tag{ID: tag.ID}, "DeletedAt"); err == nil {
+		t.Errorf("Expected an error updating the soft_delete field")
+	}
+	if _, err := db.Upsert(&Tag{Key: "a"}, OnConflict{Columns: []string{"key"}, DoUpdate: []string{"deleted_at"}}); err == nil {
+		t.Errorf("Expected an error upserting the soft_delete field")
+	}
+
+	// an unscoped handle updates the deleted row, which stays deleted
+	if n, err := db.Unscoped().Update(&Tag{ID: tag.ID, Key: "a", Count: 4}); err != nil || n != 1 {
+		t.Errorf("Expected 1 tag updated but found %d, %v", n, err)
+	}
+	outcome, err = db.Unscoped().Upsert(&Tag{Key: "a", Count: 5}, OnConflict{Columns: []string{"key"}})
+	if err != nil || outcome != UpsertUpdated {
+		t.Errorf("Expected the tag to be updated but found %v, %v", outcome, err)
+	}
+	found = &Tag{}
+	if err := db.Unscoped().TryFirst(found); err != nil || found.DeletedAt == nil || found.Count != 5 {
+		t.Errorf("Expected the tag to stay deleted with count 5 but found %+v, %v", found, err)
+	}
+
+	if _, err := db.Restore(&Tag{ID: tag.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Update(&Tag{ID: tag.ID, Key: "a", Count: 6}); err != nil || n != 1 {
+		t.Errorf("Expected the restored tag updated but found %d, %v", n, err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Memo{})
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+	memos := []Memo{{Text: "a"}, {Text: "b"}}
+	if err := db.CreateMany(&memos); err != nil {
+		t.Fatal(err)
+	}
+	db.Delete(&memos[0])
+	db.Delete(&memos[1])
+
+	// a model read back unscoped still matches its row
+	deleted := Memo{}
+	if err := db.Unscoped().Model(&Memo{}).Where("text = ?", "a").First(&deleted); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Restore(&deleted); err != nil || n != 1 {
+		t.Errorf("Expected 1 memo restored but found %d, %v", n, err)
+	}
+	if n, err := db.Restore(&Memo{Text: "a"}); err != nil || n != 0 {
+		t.Errorf("Expected no memo restored twice but found %d, %v", n, err)
+	}
+	results := []Memo{}
+	db.Find(&results)
+	if len(results) != 1 || results[0].Text != "a" || !results[0].DeletedAt.IsZero() {
+		t.Errorf("Expected a to be back but found %v", results)
+	}
+
+	entries, err := db.AuditTrail(&Memo{})
+	if err != nil || len(entries) != 5 {
+		t.Fatalf("Expected 5 audit entries but found %v, %v", entries, err)
+	}
+	if entries[2].Operation != AuditDelete || entries[4].Operation != AuditUpdate {
+		t.Errorf("Expected a delete and a restore but found %v and %v", entries[2].Operation, entries[4].Operation)
+	}
+
+	if _, err := db.Restore(&Post{ID: 1}); err == nil {
+		t.Errorf("Expected an error restoring a model without a soft_delete field")
+	}
+	if _, err := db.Restore(&Memo{}); err == nil {
+		t.Errorf("Expected an error restoring an empty model")
+	}
+	db.Grant("alice", "SELECT, DELETE ON memo")
+	if _, err := db.As("alice").Restore(&Memo{Text: "b"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied but got %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Note{})
+	notes := []Note{{Text: "old"}, {Text: "new"}, {Text: "live"}}
+	if err := db.CreateMany(&notes); err != nil {
+		t.Fatal(err)
+	}
+	db.Delete(&notes[0])
+	db.Delete(&notes[1])
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	if _, err := db.Exec("update note set deleted_at = ? where text = 'old'", old); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := db.Purge(&Note{}, 24*time.Hour); err != nil || n != 1 {
+		t.Errorf("Expected 1 note purged but found %d, %v", n, err)
+	}
+	results := []Note{}
+	db.Unscoped().Find(&results)
+	if len(results) != 2 || results[0].Text != "new" {
+		t.Errorf("Expected new and live left but found %v", noteTexts(results))
+	}
+	if n, err := db.Purge(&Note{}, 0); err != nil || n != 1 {
+		t.Errorf("Expected the new note purged but found %d, %v", n, err)
+	}
+
+	if _, err := db.Purge(&Post{}, 0); err == nil {
+		t.Errorf("Expected an error purging a model without a soft_delete field")
+	}
+}
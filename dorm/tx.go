@@ -0,0 +1,148 @@
+package dorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Tx is a DB handle bound to a database transaction. It exposes the same
+// Find/First/Create/Filter/Delete/Query API as DB, and every statement it
+// issues runs inside the transaction until Commit or Rollback is called.
+//
+// Calling Begin or Transaction on a Tx opens a nested transaction backed by
+// a SAVEPOINT, so helpers that open their own transaction compose with a
+// caller's.
+type Tx struct {
+	DB
+}
+
+// txState is the state shared by a DB handle and the Tx it belongs to.
+type txState struct {
+	sqlConn   *sql.Conn // the connection the transaction runs on
+	sqlTx     *sql.Tx
+	savepoint string // empty for the outermost transaction
+	depth     int
+	done      bool
+	ended     func() // run on sqlConn once the outermost transaction ends
+}
+
+// Begin starts a transaction. If db is itself a transaction, Begin starts a
+// nested transaction using a savepoint.
+func (db *DB) Begin() (*Tx, error) {
+	return db.begin(nil)
+}
+
+// begin is like Begin, but if it starts an outermost transaction, it first
+// calls prepare, if not nil, on the transaction's connection, for settings
+// sqlite only allows outside a transaction. The function prepare returns
+// is called on the connection once the transaction has ended.
+func (db *DB) begin(prepare func(ctx context.Context, conn *sql.Conn) (func(), error)) (*Tx, error) {
+	if db.tx != nil {
+		depth := db.tx.depth + 1
+		name := fmt.Sprintf("dorm_savepoint_%d", depth)
+		if _, err := db.exec("SAVEPOINT " + name); err != nil {
+			return nil, wrapErr("Begin", "", err)
+		}
+		tx := &Tx{DB: *db}
+		tx.tx = &txState{sqlConn: db.tx.sqlConn, sqlTx: db.tx.sqlTx, savepoint: name, depth: depth}
+		return tx, nil
+	}
+
+	ctx := db.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// the transaction keeps its connection so that hooks such as the
+	// authorizer can be installed on it
+	sqlConn, err := db.inner.Conn(ctx)
+	if err != nil {
+		return nil, wrapErr("Begin", "", err)
+	}
+	ended := func() {}
+	if prepare != nil {
+		if ended, err = prepare(ctx, sqlConn); err != nil {
+			sqlConn.Close()
+			return nil, wrapErr("Begin", "", err)
+		}
+	}
+	sqlTx, err := sqlConn.BeginTx(ctx, nil)
+	if err != nil {
+		ended()
+		sqlConn.Close()
+		return nil, wrapErr("Begin", "", err)
+	}
+	tx := &Tx{DB: *db}
+	tx.conn = sqlTx
+	tx.tx = &txState{sqlConn: sqlConn, sqlTx: sqlTx, ended: ended}
+	return tx, nil
+}
+
+// Commit commits the transaction, or releases its savepoint if it is
+// nested.
+func (tx *Tx) Commit() error {
+	if tx.tx.done {
+		return wrapErr("Commit", "", sql.ErrTxDone)
+	}
+	tx.tx.done = true
+	if tx.tx.savepoint != "" {
+		_, err := tx.exec("RELEASE SAVEPOINT " + tx.tx.savepoint)
+		return wrapErr("Commit", "", err)
+	}
+	defer tx.tx.sqlConn.Close()
+	defer tx.tx.ended()
+	return wrapErr("Commit", "", tx.tx.sqlTx.Commit())
+}
+
+// Rollback aborts the transaction, or rolls back to its savepoint if it is
+// nested. Calling Rollback after Commit or Rollback has no effect.
+func (tx *Tx) Rollback() error {
+	if tx.tx.done {
+		return nil
+	}
+	tx.tx.done = true
+	// the schema cache may hold tables created in the transaction
+	defer tx.invalidateSchema()
+	if tx.tx.savepoint != "" {
+		_, err := tx.exec("ROLLBACK TO SAVEPOINT " + tx.tx.savepoint + "; RELEASE SAVEPOINT " + tx.tx.savepoint)
+		return wrapErr("Rollback", "", err)
+	}
+	defer tx.tx.sqlConn.Close()
+	defer tx.tx.ended()
+	return wrapErr("Rollback", "", tx.tx.sqlTx.Rollback())
+}
+
+// Transaction runs fn inside a transaction. The transaction is committed if
+// fn returns nil, and rolled back if fn returns an error or panics; a panic
+// is re-raised after the rollback.
+
+// Example usage:
+//    err := db.Transaction(func(tx *dorm.Tx) error {
+//        tx.Create(post)
+//        _, err := tx.TryDelete(draft)
+//        return err
+//    })
+func (db *DB) Transaction(fn func(tx *Tx) error) error {
+	return db.transaction(nil, fn)
+}
+
+// transaction is like Transaction, but starts the transaction with begin,
+// passing it prepare.
+func (db *DB) transaction(prepare func(ctx context.Context, conn *sql.Conn) (func(), error), fn func(tx *Tx) error) error {
+	tx, err := db.begin(prepare)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
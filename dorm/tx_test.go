@@ -0,0 +1,148 @@
+package dorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func countUsers(db *DB) int {
+	results := []User{}
+	db.Find(&results)
+	return len(results)
+}
+
+func TestBeginCommitRollback(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Create(&User{FullName: "Frelicia"})
+	tx.Delete(&User{FullName: "Alice Apple"})
+	if n := countUsers(&tx.DB); n != len(MockUsers) {
+		t.Errorf("Expected %d users inside the transaction but found %d", len(MockUsers), n)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := []User{}
+	db.Filter(&result, &User{FullName: "Frelicia"})
+	if len(result) != 0 || countUsers(&db) != len(MockUsers) {
+		t.Errorf("Expected the rolled back transaction to have no effect")
+		fmt.Println(result)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Create(&User{FullName: "Frelicia"})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expected an error committing twice")
+	}
+	if n := countUsers(&db); n != len(MockUsers)+1 {
+		t.Errorf("Expected %d users but found %d", len(MockUsers)+1, n)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	err := db.Transaction(func(tx *Tx) error {
+		tx.Create(&User{FullName: "Frelicia"})
+		return nil
+	})
+	if err != nil || countUsers(&db) != len(MockUsers)+1 {
+		t.Errorf("Expected the transaction to commit but got %v", err)
+	}
+
+	errAbort := errors.New("abort")
+	err = db.Transaction(func(tx *Tx) error {
+		tx.Create(&User{FullName: "Kyra"})
+		return errAbort
+	})
+	if err != errAbort || countUsers(&db) != len(MockUsers)+1 {
+		t.Errorf("Expected the transaction to roll back but got %v", err)
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+	insertUsers(conn, MockUsers)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("The code did not panic")
+			}
+		}()
+		db.Transaction(func(tx *Tx) error {
+			tx.Create(&User{FullName: "Frelicia"})
+			type UserFake struct {
+				FullName string
+			}
+			tx.Create(&UserFake{FullName: "Frelicia"})
+			return nil
+		})
+	}()
+
+	if n := countUsers(&db); n != len(MockUsers) {
+		t.Errorf("Expected %d users but found %d", len(MockUsers), n)
+	}
+}
+
+// Check that a nested transaction can roll back without aborting its parent
+func TestNestedTransaction(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	err := db.Transaction(func(tx *Tx) error {
+		tx.Create(&User{FullName: "outer"})
+		inner := tx.Transaction(func(tx *Tx) error {
+			tx.Create(&User{FullName: "inner"})
+			return errors.New("abort inner")
+		})
+		if inner == nil {
+			t.Errorf("Expected the inner transaction to fail")
+		}
+		return tx.Transaction(func(tx *Tx) error {
+			tx.Create(&User{FullName: "sibling"})
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []User{}
+	db.Find(&results)
+	if len(results) != 2 || results[0].FullName != "outer" || results[1].FullName != "sibling" {
+		t.Errorf("incorrect")
+		fmt.Println(results)
+	}
+}
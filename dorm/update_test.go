@@ -0,0 +1,119 @@
+package dorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestUpdate(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	post := &Post{}
+	if err := db.Model(&Post{}).Where("id = ?", 2).First(post); err != nil {
+		t.Fatal(err)
+	}
+	post.Author = "bobby"
+	post.Likes = 100
+	n, err := db.Update(post)
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 row updated but got %d, %v", n, err)
+	}
+
+	updated := &Post{}
+	if err := db.Model(&Post{}).Where("id = ?", 2).First(updated); err != nil {
+		t.Fatal(err)
+	}
+	if *updated != *post {
+		t.Errorf("Expected %v but found %v", *post, *updated)
+	}
+
+	// the other rows are untouched
+	results := []Post{}
+	db.Find(&results)
+	if len(results) != len(MockPosts) || results[0] != (Post{ID: 1, Author: "alice", Likes: 5}) {
+		t.Errorf("incorrect")
+		fmt.Println(results)
+	}
+
+	n, err = db.Update(&Post{ID: 42, Author: "nobody"})
+	if err != nil || n != 0 {
+		t.Errorf("Expected 0 rows updated but got %d, %v", n, err)
+	}
+}
+
+func TestUpdateColumns(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	n, err := db.UpdateColumns(&Post{ID: 1, Author: "ignored", Likes: 7}, "likes")
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 row updated but got %d, %v", n, err)
+	}
+
+	post := &Post{}
+	db.First(post)
+	if *post != (Post{ID: 1, Author: "alice", Likes: 7}) {
+		t.Errorf("incorrect")
+		fmt.Println(*post)
+	}
+
+	if _, err := db.UpdateColumns(&Post{ID: 1}, "Body"); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+}
+
+func TestSave(t *testing.T) {
+	conn := connectSQL()
+	createPostTable(conn)
+	insertPosts(conn, MockPosts)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	post := &Post{Author: "dave", Likes: 1}
+	if n, err := db.Save(post); err != nil || n != 1 {
+		t.Errorf("Expected 1 row saved but got %d, %v", n, err)
+	}
+	if post.ID != int64(len(MockPosts)+1) {
+		t.Errorf("Expected ID %d but found %d", len(MockPosts)+1, post.ID)
+	}
+
+	post.Likes = 2
+	if n, err := db.Save(post); err != nil || n != 1 {
+		t.Errorf("Expected 1 row saved but got %d, %v", n, err)
+	}
+
+	results := []Post{}
+	db.Find(&results)
+	if len(results) != len(MockPosts)+1 || results[len(results)-1] != *post {
+		t.Errorf("incorrect")
+		fmt.Println(results)
+	}
+}
+
+func TestUpdateNoPrimaryKey(t *testing.T) {
+	conn := connectSQL()
+	createUserTable(conn)
+
+	db := NewDB(conn)
+	defer db.Close()
+
+	if _, err := db.Update(&User{FullName: "Frelicia"}); !errors.Is(err, ErrNoPrimaryKey) {
+		t.Errorf("Expected ErrNoPrimaryKey but got %v", err)
+	}
+	if _, err := db.Save(&User{FullName: "Frelicia"}); !errors.Is(err, ErrNoPrimaryKey) {
+		t.Errorf("Expected ErrNoPrimaryKey but got %v", err)
+	}
+}
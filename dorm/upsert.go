@@ -0,0 +1,243 @@
+package dorm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Outcomes reported by Upsert.
+const (
+	UpsertInserted = "INSERTED"
+	UpsertUpdated  = "UPDATED"
+	UpsertIgnored  = "IGNORED"
+)
+
+// OnConflict says what Upsert does when the row it inserts conflicts with
+// an existing row on a UNIQUE constraint.
+type OnConflict struct {
+	Columns   []string // the conflict target, as field or column names; may be empty with DoNothing
+	DoUpdate  []string // the fields or columns of the existing row to overwrite; all but Columns if empty
+	DoNothing bool     // leave the existing row as it is
+}
+
+// Upsert inserts model, like Create, unless the row conflicts with an
+// existing one on conflict.Columns, in which case the existing row is
+// updated with the fields named by conflict.DoUpdate, or left alone if
+// conflict.DoNothing is set. It returns UpsertInserted, UpsertUpdated or
+// UpsertIgnored, and back-fills the primary key of model with the ID of the
+// row inserted or updated. Unlike INSERT OR REPLACE, a conflicting row is
+// never deleted, so its ID is kept and no delete triggers fire.
+//
+// Session users need INSERT on the table, and UPDATE on the columns to be
+// updated; row-level security policies decide which existing rows they may
+// update, and a conflict with any other row is ignored. So is a conflict
+// with a soft-deleted row, unless db is Unscoped, and a soft_delete field
+// is never updated.
+
+// Example usage:
+//    outcome, err := db.Upsert(&User2{FullName: "Frelicia", EMail: "f@x.org"},
+//        dorm.OnConflict{Columns: []string{"e_mail"}, DoUpdate: []string{"full_name"}})
+func (db *DB) Upsert(model interface{}, conflict OnConflict) (string, error) {
+	outcome := ""
+	err := db.audited(func(db *DB) error {
+		return db.Transaction(func(tx *Tx) (err error) {
+			outcome, err = tx.upsert(model, conflict)
+			return err
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return outcome, nil
+}
+
+// upsert does the work of Upsert, recording the row inserted or updated in
+// the audit log.
+func (db *DB) upsert(model interface{}, conflict OnConflict) (string, error) {
+	name := db.tableName(model)
+	t := reflect.TypeOf(model).Elem()
+	v := reflect.ValueOf(model).Elem()
+	if err := checkFields("Upsert", name, t); err != nil {
+		return "", err
+	}
+	if len(conflict.Columns) == 0 && !conflict.DoNothing {
+		return "", newErr("Upsert", name, nil, "OnConflict must name the Columns to update on")
+	}
+	grants, err := db.authorize("Upsert", PrivInsert, name)
+	if err != nil {
+		return "", err
+	}
+	cols, fields, primaryKey, err := db.insertColumns("Upsert", name, t)
+	if err != nil {
+		return "", err
+	}
+	if err := db.authorizeInsert("Upsert", grants, name, cols, fields, []reflect.Value{v}); err != nil {
+		return "", err
+	}
+
+	target, targetFields, err := db.fieldColumns("Upsert", name, t, conflict.Columns)
+	if err != nil {
+		return "", err
+	}
+	updates := []string{}
+	if !conflict.DoNothing {
+		var updateFields []int
+		updates, updateFields, err = db.fieldColumns("Upsert", name, t, conflict.DoUpdate)
+		if err != nil {
+			return "", err
+		}
+		sd := typeOf(t).softDelete
+		for _, i := range updateFields {
+			if i == sd {
+				return "", newErr("Upsert", name, nil, "field %v is only changed by Delete and Restore", t.Field(i).Name)
+			}
+		}
+		if len(conflict.DoUpdate) == 0 {
+			updates = without(cols, target)
+			if sd >= 0 {
+				updates = without(updates, []string{db.columnName(t, sd)})
+			}
+		}
+		if len(updates) == 0 {
+			conflict.DoNothing = true
+		}
+	}
+	if !conflict.DoNothing {
+		grants, err := db.authorize("Upsert", PrivUpdate, name)
+		if err != nil {
+			return "", err
+		}
+		if err := db.authorizeColumns("Upsert", grants, PrivUpdate, name, updates); err != nil {
+			return "", err
+		}
+	}
+
+	// find the row the new one would conflict with, if any
+	existing := int64(0)
+	if len(target) > 0 {
+		conds := make([]string, len(target))
+		args := make([]interface{}, len(target))
+		for i, col := range target {
+			conds[i] = col + " = ?"
+			args[i] = v.Field(targetFields[i]).Interface()
+		}
+		err := db.query(func(rows *sql.Rows) error {
+			if rows.Next() {
+				return rows.Scan(&existing)
+			}
+			return rows.Err()
+		}, "SELECT rowid FROM "+name+" WHERE "+strings.Join(conds, " AND "), args...)
+		if err != nil {
+			return "", wrapErr("Upsert", name, err)
+		}
+	}
+	var before []rowSnapshot
+	if existing != 0 {
+		if before, err = db.snapshotRowids(name, []int64{existing}); err != nil {
+			return "", wrapErr("Upsert", name, err)
+		}
+	}
+
+	args := []interface{}{}
+	for _, f := range fields {
+		args = append(args, v.Field(f).Interface())
+	}
+	query := fmt.Sprintf("INSERT INTO %v(%v) VALUES(%v) ON CONFLICT", name, strings.Join(cols, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", "))
+	if len(target) > 0 {
+		query += " (" + strings.Join(target, ", ") + ")"
+	}
+	if conflict.DoNothing {
+		query += " DO NOTHING"
+	} else {
+		sets := make([]string, len(updates))
+		for i, col := range updates {
+			sets[i] = col + " = excluded." + col
+		}
+		query += " DO UPDATE SET " + strings.Join(sets, ", ")
+		conds := []string{}
+		if scope, scopeArgs := db.softDeleteScope(t); scope != "" {
+			conds = append(conds, scope)
+			args = append(args, scopeArgs...)
+		}
+		if policy, policyArgs := db.rowPolicy(name); policy != "" {
+			conds = append(conds, policy)
+			args = append(args, policyArgs...)
+		}
+		if len(conds) > 0 {
+			query += " WHERE " + strings.Join(conds, " AND ")
+		}
+	}
+	res, err := db.exec(query, args...)
+	if err != nil {
+		return "", wrapErr("Upsert", name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", wrapErr("Upsert", name, err)
+	}
+
+	// the existing row's ID is not reported when the conflict is ignored,
+	// since a policy may hide the row from the session user
+	if n == 0 {
+		return UpsertIgnored, nil
+	}
+	outcome, rowid := UpsertUpdated, existing
+	if existing == 0 {
+		outcome = UpsertInserted
+		if rowid, err = res.LastInsertId(); err != nil {
+			return "", wrapErr("Upsert", name, err)
+		}
+	}
+	if primaryKey >= 0 {
+		setRowid(v.Field(primaryKey), rowid)
+	}
+
+	after, err := db.snapshotRowids(name, []int64{rowid})
+	if err != nil {
+		return "", wrapErr("Upsert", name, err)
+	}
+	operation := AuditInsert
+	if outcome == UpsertUpdated {
+		operation = AuditUpdate
+	}
+	return outcome, wrapErr("Upsert", name, db.auditRows(operation, name, before, after, ""))
+}
+
+// fieldColumns returns the columns for names, given as Go field names or
+// column names of the struct type t, and the indices of their fields.
+func (db *DB) fieldColumns(op string, table string, t reflect.Type, names []string) ([]string, []int, error) {
+	cols := []string{}
+	fields := []int{}
+	for _, name := range names {
+		i, ok := db.fieldByName(t, name)
+		if !ok {
+			return nil, nil, newErr(op, table, nil, "unknown field %q", name)
+		}
+		if typeOf(t).readonly[i] {
+			return nil, nil, newErr(op, table, nil, "field %v is read-only", t.Field(i).Name)
+		}
+		cols = append(cols, db.columnName(t, i))
+		fields = append(fields, i)
+	}
+	return cols, fields, nil
+}
+
+// without returns the strings of all that are not in some.
+func without(all []string, some []string) []string {
+	out := []string{}
+	for _, s := range all {
+		found := false
+		for _, x := range some {
+			if strings.EqualFold(s, x) {
+				found = true
+			}
+		}
+		if !found {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package dorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCreateDoesNotReplace(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Account{})
+	db.Create(&Account{Handle: "alice", Karma: 1})
+	if err := db.TryCreate(&Account{Handle: "alice", Karma: 2}); !errors.Is(err, ErrConstraintViolation) {
+		t.Errorf("Expected ErrConstraintViolation but got %v", err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Account{})
+	if err := db.EnableAudit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&Account{Handle: "bob"})
+
+	alice := &Account{Handle: "alice", Bio: "first", Karma: 1}
+	outcome, err := db.Upsert(alice, OnConflict{Columns: []string{"Handle"}, DoUpdate: []string{"karma"}})
+	if err != nil || outcome != UpsertInserted || alice.ID != 2 {
+		t.Errorf("Expected alice to be inserted with ID 2 but found %v, %d, %v", outcome, alice.ID, err)
+	}
+
+	again := &Account{Handle: "alice", Bio: "second", Karma: 5}
+	outcome, err = db.Upsert(again, OnConflict{Columns: []string{"handle"}, DoUpdate: []string{"karma"}})
+	if err != nil || outcome != UpsertUpdated || again.ID != 2 {
+		t.Errorf("Expected alice to be updated in place but found %v, %d, %v", outcome, again.ID, err)
+	}
+	stored := []Account{}
+	db.Filter(&stored, &Account{Handle: "alice"})
+	if len(stored) != 1 || stored[0].Karma != 5 || stored[0].Bio != "first" {
+		t.Errorf("Expected only karma to be updated but found %v", stored)
+	}
+
+	// without DoUpdate every column but the target is updated
+	outcome, err = db.Upsert(&Account{Handle: "alice", Bio: "third"}, OnConflict{Columns: []string{"handle"}})
+	stored = []Account{}
+	db.Filter(&stored, &Account{Handle: "alice"})
+	if err != nil || outcome != UpsertUpdated || stored[0].Bio != "third" || stored[0].Karma != 0 {
+		t.Errorf("Expected every column to be updated but found %v, %v, %v", outcome, stored, err)
+	}
+
+	outcome, err = db.Upsert(&Account{Handle: "alice", Bio: "fourth"}, OnConflict{DoNothing: true})
+	if err != nil || outcome != UpsertIgnored {
+		t.Errorf("Expected the conflict to be ignored but found %v, %v", outcome, err)
+	}
+
+	entries, _ := db.AuditTrail(&Account{ID: 2})
+	expected := []string{AuditInsert, AuditUpdate, AuditUpdate}
+	if !reflect.DeepEqual(auditOperations(entries), expected) {
+		t.Errorf("Expected %v but found %v", expected, auditOperations(entries))
+	}
+
+	if _, err := db.Upsert(&Account{Handle: "carol"}, OnConflict{}); err == nil {
+		t.Errorf("Expected an error for an OnConflict without Columns")
+	}
+	if _, err := db.Upsert(&Account{Handle: "carol"}, OnConflict{Columns: []string{"nope"}}); err == nil {
+		t.Errorf("Expected an error for an unknown conflict column")
+	}
+}
+
+func TestUpsertPermissions(t *testing.T) {
+	conn := connectSQL()
+	db := NewDB(conn)
+	defer db.Close()
+
+	db.CreateTable(&Account{})
+	db.Create(&Account{Handle: "alice", Bio: "mine"})
+	db.Create(&Account{Handle: "bob", Bio: "mine"})
+	db.Grant("alice", "SELECT, INSERT ON account")
+	db.Policy(&Account{}, "handle = :current_user")
+
+	conflict := OnConflict{Columns: []string{"handle"}, DoUpdate: []string{"bio"}}
+	if _, err := db.As("alice").Upsert(&Account{Handle: "alice", Bio: "new"}, conflict); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied without UPDATE but got %v", err)
+	}
+
+	db.Grant("alice", "UPDATE(bio) ON account")
+	outcome, err := db.As("alice").Upsert(&Account{Handle: "alice", Bio: "new"}, conflict)
+	if err != nil || outcome != UpsertUpdated {
+		t.Errorf("Expected alice's row to be updated but found %v, %v", outcome, err)
+	}
+
+	// the policy keeps alice from updating bob's row
+	bob := &Account{Handle: "bob", Bio: "hacked"}
+	outcome, err = db.As("alice").Upsert(bob, conflict)
+	if err != nil || outcome != UpsertIgnored || bob.ID != 0 {
+		t.Errorf("Expected bob's row to be left alone but found %v, %d, %v", outcome, bob.ID, err)
+	}
+	stored := []Account{}
+	db.Filter(&stored, &Account{Handle: "bob"})
+	if stored[0].Bio != "mine" {
+		t.Errorf("Expected bob's bio to be unchanged but found %v", stored[0].Bio)
+	}
+}